@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/go-acme/lego/v4/registration"
+
+	"github.com/quara-dev/letsgo-nats/acme"
+	"github.com/quara-dev/letsgo-nats/configuration"
+	"github.com/quara-dev/letsgo-nats/stores"
+)
+
+var accountUsageStr = `
+Usage: letsgo-nats account <command>
+Commands:
+    show                             Show ACME account saved for CA_DIR
+    register                         Register ACME account on CA_DIR, or resolve existing account of ACCOUNT_KEY_FILE
+`
+
+// Print ACME account
+func printAccount(config *configuration.UserConfig, reg *registration.Resource) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "Email:\t%s\n", config.Email)
+	fmt.Fprintf(w, "CA directory:\t%s\n", config.CADirURL)
+	fmt.Fprintf(w, "Account key:\t%s\n", config.AccountKeyFile)
+	fmt.Fprintf(w, "Registration:\t%s\n", acme.AccountFile(config))
+	if reg == nil {
+		fmt.Fprintf(w, "Status:\tnot registered. Use 'letsgo-nats account register' to register account.\n")
+		return w.Flush()
+	}
+	fmt.Fprintf(w, "Account URL:\t%s\n", reg.URI)
+	fmt.Fprintf(w, "Status:\t%s\n", reg.Body.Status)
+	fmt.Fprintf(w, "Contacts:\t%s\n", strings.Join(reg.Body.Contact, ", "))
+	return w.Flush()
+}
+
+// Run an account management command and return exit code
+func runAccountCommand(args []string) int {
+	if len(args) != 1 || (args[0] != "show" && args[0] != "register") {
+		fmt.Fprint(os.Stderr, accountUsageStr)
+		return 2
+	}
+	stores := stores.DefaultStores()
+	config, err := configuration.NewUserConfig(&stores)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "letsgo-nats: %v\n", err)
+		return 1
+	}
+	var reg *registration.Resource
+	if args[0] == "register" {
+		reg, err = acme.RegisterAccount(config)
+	} else {
+		reg, err = acme.LoadAccount(config)
+	}
+	if err == nil {
+		err = printAccount(config, reg)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "letsgo-nats: %v\n", err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,196 @@
+package acme
+
+import (
+	"crypto"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	legoacme "github.com/go-acme/lego/v4/acme"
+	"github.com/go-acme/lego/v4/lego"
+	"github.com/go-acme/lego/v4/log"
+	"github.com/go-acme/lego/v4/registration"
+	"golang.org/x/exp/slices"
+
+	"github.com/quara-dev/letsgo-nats/configuration"
+)
+
+// ACME error returned when resolving an account which does not exist
+const ACCOUNT_DOES_NOT_EXIST = "urn:ietf:params:acme:error:accountDoesNotExist"
+
+// Characters which cannot be used in account filenames
+var unsafeFilenameChars = regexp.MustCompile(`[^a-zA-Z0-9.-]+`)
+
+// Get path to the file holding account registration for the configured CA.
+//
+// The file is stored next to the account key, and its name is derived from
+// the CA directory URL, so that accounts of different CAs (e.g. staging and
+// production) are never mixed up.
+func AccountFile(config *configuration.UserConfig) string {
+	keyFile := config.AccountKeyFile
+	base := strings.TrimSuffix(filepath.Base(keyFile), filepath.Ext(keyFile))
+	ca := config.CADirURL
+	if u, err := url.Parse(config.CADirURL); err == nil {
+		ca = u.Host + u.Path
+	}
+	ca = strings.Trim(unsafeFilenameChars.ReplaceAllString(ca, "_"), "_")
+	return filepath.Join(filepath.Dir(keyFile), fmt.Sprintf("%s.%s.json", base, ca))
+}
+
+// Account registration saved for the configured CA
+//
+// The thumbprint of the account key is saved along with the registration, so
+// that a registration is not used with another account key.
+type savedRegistration struct {
+	registration.Resource
+	KeyThumbprint string `json:"key_thumbprint,omitempty"`
+}
+
+// Get the thumbprint of an account key, I.E, the SHA-256 hash of its public key
+func keyThumbprint(key crypto.PrivateKey) string {
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return ""
+	}
+	der, err := x509.MarshalPKIXPublicKey(signer.Public())
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(der)
+	return hex.EncodeToString(sum[:])
+}
+
+// Load account registration saved for the configured CA
+func loadRegistration(config *configuration.UserConfig) (*savedRegistration, error) {
+	content, err := os.ReadFile(AccountFile(config))
+	if err != nil {
+		return nil, err
+	}
+	saved := &savedRegistration{}
+	err = json.Unmarshal(content, saved)
+	if err != nil {
+		return nil, err
+	}
+	return saved, nil
+}
+
+// Save account registration for the configured CA
+func saveRegistration(config *configuration.UserConfig, reg *registration.Resource) error {
+	saved := savedRegistration{Resource: *reg, KeyThumbprint: keyThumbprint(config.Key)}
+	content, err := json.MarshalIndent(saved, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(AccountFile(config), content, 0o600)
+}
+
+// Check if a saved registration can be used as is
+func isStaleRegistration(config *configuration.UserConfig, saved *savedRegistration) bool {
+	if saved.URI == "" || saved.Body.Status != "valid" {
+		return true
+	}
+	// Account key was rotated, or registration was saved without key thumbprint
+	if saved.KeyThumbprint == "" || saved.KeyThumbprint != keyThumbprint(config.Key) {
+		return true
+	}
+	return !slices.Contains(saved.Body.Contact, "mailto:"+config.Email)
+}
+
+// Get account registration saved for user, or nil when it cannot be used as is.
+//
+// Saved registration must be set on user before lego client is created, so
+// that requests are signed with the account URL.
+func savedAccount(config *configuration.UserConfig) *registration.Resource {
+	saved, err := loadRegistration(config)
+	if err != nil || isStaleRegistration(config, saved) {
+		return nil
+	}
+	return &saved.Resource
+}
+
+// Check if an error means that no account exists for the account key
+func isAccountDoesNotExist(err error) bool {
+	var problem *legoacme.ProblemDetails
+	return errors.As(err, &problem) && problem.Type == ACCOUNT_DOES_NOT_EXIST
+}
+
+// Get account registration for user, when no saved registration can be used.
+//
+// The account is resolved from the account key, and registered when it does
+// not exist yet. Registration is saved for later use.
+func getRegistration(client *lego.Client, config *configuration.UserConfig) (*registration.Resource, error) {
+	reg, err := client.Registration.ResolveAccountByKey()
+	if err != nil {
+		if !isAccountDoesNotExist(err) {
+			return nil, errors.New(fmt.Sprintf("Failed to resolve ACME account: %v", err))
+		}
+		log.Infof("[%s] No existing account found for account key, registering a new account", config.Email)
+		reg, err = registerAccount(client, config)
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = saveRegistration(config, reg)
+	if err != nil {
+		log.Warnf("[%s] Failed to save account registration: %v", config.Email, err)
+	}
+	return reg, nil
+}
+
+// Load account registration saved for the configured CA, or nil when account is not registered yet
+func LoadAccount(config *configuration.UserConfig) (*registration.Resource, error) {
+	saved, err := loadRegistration(config)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &saved.Resource, nil
+}
+
+// Register account on the configured CA, or resolve the existing account of account key.
+//
+// Registration is saved for later use.
+func RegisterAccount(config *configuration.UserConfig) (*registration.Resource, error) {
+	if reg := savedAccount(config); reg != nil {
+		return reg, nil
+	}
+	legoConfig := lego.NewConfig(&User{Email: config.Email, Key: config.Key})
+	legoConfig.CADirURL = config.CADirURL
+	client, err := lego.NewClient(legoConfig)
+	if err != nil {
+		return nil, err
+	}
+	return getRegistration(client, config)
+}
+
+// Register a new account
+//
+// External Account Binding is used when configured, as required by
+// commercial and enterprise CAs.
+func registerAccount(client *lego.Client, config *configuration.UserConfig) (*registration.Resource, error) {
+	var reg *registration.Resource
+	var err error
+	if config.EABKid != "" {
+		reg, err = client.Registration.RegisterWithExternalAccountBinding(registration.RegisterEABOptions{
+			TermsOfServiceAgreed: config.TermsOfServiceAgreed,
+			Kid:                  config.EABKid,
+			HmacEncoded:          config.EABHmac,
+		})
+	} else {
+		reg, err = client.Registration.Register(registration.RegisterOptions{TermsOfServiceAgreed: config.TermsOfServiceAgreed})
+	}
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Failed to register ACME account: %v", err))
+	}
+	return reg, nil
+}
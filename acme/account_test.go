@@ -0,0 +1,215 @@
+package acme
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	legoacme "github.com/go-acme/lego/v4/acme"
+	"github.com/go-acme/lego/v4/registration"
+
+	"github.com/quara-dev/letsgo-nats/configuration"
+	"github.com/quara-dev/letsgo-nats/constants"
+)
+
+func newTestAccountKey(t *testing.T) crypto.PrivateKey {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	return key
+}
+
+// Minimal ACME server handling account requests
+type testCA struct {
+	*httptest.Server
+	// Status of problem returned on new account requests, accounts exist when zero
+	newAccountProblem int
+
+	mu          sync.Mutex
+	newAccounts int
+	kids        []string
+}
+
+func newTestCA(t *testing.T, newAccountProblem int) *testCA {
+	ca := &testCA{newAccountProblem: newAccountProblem}
+	ca.Server = httptest.NewServer(http.HandlerFunc(ca.handle))
+	t.Cleanup(ca.Close)
+	return ca
+}
+
+func (ca *testCA) handle(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Replay-Nonce", "nonce")
+	switch r.URL.Path {
+	case "/directory":
+		json.NewEncoder(w).Encode(map[string]string{
+			"newNonce":   ca.URL + "/nonce",
+			"newAccount": ca.URL + "/new-account",
+			"newOrder":   ca.URL + "/new-order",
+			"revokeCert": ca.URL + "/revoke",
+			"keyChange":  ca.URL + "/key-change",
+		})
+		return
+	case "/nonce":
+		return
+	}
+	// Record key identifier of signed requests
+	body, _ := io.ReadAll(r.Body)
+	jws := struct {
+		Protected string `json:"protected"`
+	}{}
+	json.Unmarshal(body, &jws)
+	protected, _ := base64.RawURLEncoding.DecodeString(jws.Protected)
+	header := struct {
+		Kid string `json:"kid"`
+	}{}
+	json.Unmarshal(protected, &header)
+	ca.mu.Lock()
+	ca.kids = append(ca.kids, header.Kid)
+	if r.URL.Path == "/new-account" {
+		ca.newAccounts += 1
+	}
+	ca.mu.Unlock()
+	if r.URL.Path == "/new-account" && ca.newAccountProblem != 0 {
+		w.Header().Set("Content-Type", "application/problem+json")
+		w.WriteHeader(ca.newAccountProblem)
+		fmt.Fprintf(w, `{"type": "urn:ietf:params:acme:error:serverInternal", "detail": "unavailable", "status": %d}`, ca.newAccountProblem)
+		return
+	}
+	w.Header().Set("Location", ca.URL+"/account/1")
+	fmt.Fprint(w, `{"status": "valid", "contact": ["mailto:support@example.com"]}`)
+}
+
+func newTestAccountConfig(t *testing.T, ca *testCA) configuration.UserConfig {
+	return configuration.UserConfig{
+		Email:          "support@example.com",
+		AccountKeyFile: filepath.Join(t.TempDir(), "account.key"),
+		CADirURL:       ca.URL + "/directory",
+		Key:            newTestAccountKey(t),
+		Challenge:      constants.ACME_CHALLENGE_HTTP01,
+		HTTPAddress:    "127.0.0.1:0",
+	}
+}
+
+// Test that account files are keyed by CA directory URL
+func TestAccountFile(t *testing.T) {
+	config := &configuration.UserConfig{
+		AccountKeyFile: "/data/account.key",
+		CADirURL:       constants.ACME_STAGING_CA_DIR,
+	}
+	got := AccountFile(config)
+	want := filepath.Join("/data", "account.acme-staging-v02.api.letsencrypt.org_directory.json")
+	if got != want {
+		t.Errorf("got %q, wanted %q", got, want)
+	}
+	config.CADirURL = constants.ACME_PRODUCTION_CA_DIR
+	if AccountFile(config) == got {
+		t.Errorf("Staging and production accounts must be stored in different files")
+	}
+}
+
+// Test that saved registrations are loaded and checked
+func TestSaveAndLoadRegistration(t *testing.T) {
+	key := newTestAccountKey(t)
+	config := &configuration.UserConfig{
+		Email:          "support@example.com",
+		AccountKeyFile: filepath.Join(t.TempDir(), "account.key"),
+		CADirURL:       constants.ACME_STAGING_CA_DIR,
+		Key:            key,
+	}
+	_, err := loadRegistration(config)
+	if err == nil {
+		t.Fatalf("Expected error when no registration is saved")
+	}
+	reg := &registration.Resource{URI: "https://ca/acct/1"}
+	reg.Body.Status = "valid"
+	reg.Body.Contact = []string{"mailto:support@example.com"}
+	err = saveRegistration(config, reg)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	loaded, err := loadRegistration(config)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if loaded.URI != reg.URI {
+		t.Errorf("Bad account URI. Want: %s. Got: %s", reg.URI, loaded.URI)
+	}
+	if isStaleRegistration(config, loaded) {
+		t.Errorf("Registration should not be stale")
+	}
+	config.Key = newTestAccountKey(t)
+	if !isStaleRegistration(config, loaded) {
+		t.Errorf("Registration should be stale when account key changed")
+	}
+	config.Key = key
+	config.Email = "other@example.com"
+	if !isStaleRegistration(config, loaded) {
+		t.Errorf("Registration should be stale when email changed")
+	}
+}
+
+// Test that a client created with a saved registration signs requests with the account URL
+func TestNewClientWithSavedRegistration(t *testing.T) {
+	ca := newTestCA(t, 0)
+	config := newTestAccountConfig(t, ca)
+	// First client resolves account and saves registration
+	if _, err := NewClient(config); err != nil {
+		t.Fatalf(err.Error())
+	}
+	// Second client uses saved registration
+	client, err := NewClient(config)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if ca.newAccounts != 1 {
+		t.Errorf("Bad number of new account requests. Want: 1. Got: %d", ca.newAccounts)
+	}
+	_, err = client.Registration.QueryRegistration()
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	want := ca.URL + "/account/1"
+	got := ca.kids[len(ca.kids)-1]
+	if got != want {
+		t.Errorf("Bad key identifier. Want: %s. Got: %s", want, got)
+	}
+}
+
+// Test that accounts are not registered when account cannot be resolved
+func TestNewClientResolveError(t *testing.T) {
+	ca := newTestCA(t, http.StatusInternalServerError)
+	config := newTestAccountConfig(t, ca)
+	if _, err := NewClient(config); err == nil {
+		t.Errorf("Expected error when account cannot be resolved")
+	}
+	if ca.newAccounts != 1 {
+		t.Errorf("Bad number of new account requests. Want: 1. Got: %d", ca.newAccounts)
+	}
+	if _, err := loadRegistration(&config); err == nil {
+		t.Errorf("Registration must not be saved when account cannot be resolved")
+	}
+}
+
+// Test that only accountDoesNotExist problems lead to account registration
+func TestIsAccountDoesNotExist(t *testing.T) {
+	if !isAccountDoesNotExist(&legoacme.ProblemDetails{Type: ACCOUNT_DOES_NOT_EXIST}) {
+		t.Errorf("accountDoesNotExist problem should be detected")
+	}
+	if isAccountDoesNotExist(&legoacme.ProblemDetails{Type: "urn:ietf:params:acme:error:serverInternal"}) {
+		t.Errorf("serverInternal problem must not be detected as accountDoesNotExist")
+	}
+	if isAccountDoesNotExist(fmt.Errorf("connection refused")) {
+		t.Errorf("Network errors must not be detected as accountDoesNotExist")
+	}
+}
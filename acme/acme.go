@@ -1,22 +1,28 @@
 package acme
 
 import (
+	"bytes"
 	"crypto"
 	"crypto/x509"
+	"encoding/json"
 	"errors"
-	"log"
+	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/go-acme/lego/v4/certcrypto"
 	"github.com/go-acme/lego/v4/certificate"
 	"github.com/go-acme/lego/v4/challenge/dns01"
 	"github.com/go-acme/lego/v4/lego"
-	"github.com/go-acme/lego/v4/providers/dns/digitalocean"
+	"github.com/go-acme/lego/v4/log"
 	"github.com/go-acme/lego/v4/registration"
 
 	"github.com/quara-dev/letsgo-nats/configuration"
+	"github.com/quara-dev/letsgo-nats/constants"
 )
 
 // User type that implements acme.User
@@ -43,10 +49,11 @@ func (u *User) GetPrivateKey() crypto.PrivateKey {
 
 // Create a new client to request certificate
 func NewClient(userConfig configuration.UserConfig) (lego.Client, error) {
-	// Generate user
+	// Generate user, using saved account registration when possible
 	user := &User{
-		Email: userConfig.Email,
-		Key:   userConfig.Key,
+		Email:        userConfig.Email,
+		Key:          userConfig.Key,
+		Registration: savedAccount(&userConfig),
 	}
 	// Generate config for user
 	legoConfig := lego.NewConfig(user)
@@ -58,19 +65,39 @@ func NewClient(userConfig configuration.UserConfig) (lego.Client, error) {
 	if err != nil {
 		return lego.Client{}, err
 	}
-	// Generate DigitalOcean provider configuration
-	providerConfig := digitalocean.NewDefaultConfig()
-	// Set auth token from user config
-	providerConfig.AuthToken = userConfig.AuthToken
-	// Use a propagation timeout of 1 minute and 30 seconds
-	providerConfig.PropagationTimeout = time.Duration(time.Second * 90)
-	// Create DigitalOcean DNS Provider
-	dnsProvider, err := digitalocean.NewDNSProviderConfig(providerConfig)
+	// Configure challenge solver
+	switch userConfig.Challenge {
+	case constants.ACME_CHALLENGE_HTTP01:
+		err = client.Challenge.SetHTTP01Provider(NewHTTP01Solver(userConfig.HTTPAddress))
+	case constants.ACME_CHALLENGE_TLSALPN01:
+		err = client.Challenge.SetTLSALPN01Provider(NewTLSALPN01Solver(userConfig.TLSAddress))
+	default:
+		err = setDNS01Provider(client, userConfig)
+	}
 	if err != nil {
 		return lego.Client{}, err
 	}
+	// Resolve or register account when no saved registration can be used
+	if user.Registration == nil {
+		reg, err := getRegistration(client, &userConfig)
+		if err != nil {
+			return lego.Client{}, err
+		}
+		user.Registration = reg
+	}
+	// Return client
+	return *client, err
+}
+
+// Use DNS provider configured by user to solve DNS-01 challenges
+func setDNS01Provider(client *lego.Client, userConfig configuration.UserConfig) error {
+	// Create DNS provider configured by user
+	dnsProvider, err := newDNSProvider(userConfig)
+	if err != nil {
+		return err
+	}
 	// Use DNS provider with some conditional options
-	err = client.Challenge.SetDNS01Provider(dnsProvider,
+	return client.Challenge.SetDNS01Provider(dnsProvider,
 		dns01.CondOption(
 			len(userConfig.DNSResolvers) > 0,
 			dns01.AddRecursiveNameservers(dns01.ParseNameservers(userConfig.DNSResolvers)),
@@ -81,18 +108,8 @@ func NewClient(userConfig configuration.UserConfig) (lego.Client, error) {
 		dns01.CondOption(userConfig.DNSTimeout > 0,
 			dns01.AddDNSTimeout(userConfig.DNSTimeout),
 		),
+		dns01.WrapPreCheck(measurePropagation()),
 	)
-	if err != nil {
-		return lego.Client{}, err
-	}
-	// Perform use registration
-	reg, err := client.Registration.Register(registration.RegisterOptions{TermsOfServiceAgreed: true})
-	if err != nil {
-		log.Fatal(err)
-	}
-	user.Registration = reg
-	// Return client
-	return *client, err
 }
 
 // Request certificate according to user configuration
@@ -104,11 +121,214 @@ func RequestCertificate(config configuration.UserConfig) (*certificate.Resource,
 	}
 	// Gather request
 	request := certificate.ObtainRequest{
-		Domains: config.Domains,
-		Bundle:  true,
+		Domains:        config.Domains,
+		Bundle:         true,
+		PreferredChain: config.PreferredChain,
 	}
 	// Send request
-	return client.Certificate.Obtain(request)
+	start := time.Now()
+	resource, err := client.Certificate.Obtain(request)
+	observeOperation("obtain", start, err)
+	if err != nil {
+		return resource, err
+	}
+	reportChain(resource, config)
+	return resource, nil
+}
+
+// Renew certificate using an existing certificate resource
+//
+// The private key of the existing certificate is reused when
+// REUSE_PRIVATE_KEY option is enabled, else a new key is generated.
+func RenewCertificate(config configuration.UserConfig, resource *certificate.Resource) (*certificate.Resource, error) {
+	// Generate lego client
+	client, err := NewClient(config)
+	if err != nil {
+		return &certificate.Resource{}, err
+	}
+	existing := *resource
+	if !config.ReusePrivateKey {
+		existing.PrivateKey = nil
+	}
+	// Send renewal request
+	start := time.Now()
+	renewed, err := client.Certificate.Renew(existing, true, false, config.PreferredChain)
+	observeOperation("renew", start, err)
+	if err != nil {
+		return renewed, err
+	}
+	reportChain(renewed, config)
+	return renewed, nil
+}
+
+// Revocation reasons accepted by ACME servers, as defined in RFC 5280
+var RevocationReasons = map[string]uint{
+	"unspecified":          0,
+	"keyCompromise":        1,
+	"affiliationChanged":   3,
+	"superseded":           4,
+	"cessationOfOperation": 5,
+}
+
+// Parse a revocation reason, either from its name or its code
+func ParseRevocationReason(value string) (uint, error) {
+	for name, code := range RevocationReasons {
+		if strings.EqualFold(value, name) || value == strconv.Itoa(int(code)) {
+			return code, nil
+		}
+	}
+	names := []string{}
+	for name := range RevocationReasons {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return 0, errors.New(fmt.Sprintf("Invalid revocation reason: %s. Allowed values are '%s'.", value, strings.Join(names, "', '")))
+}
+
+// Revoke certificates managed for user.
+//
+// Reason is a revocation reason code as defined in RFC 5280.
+func RevokeCertificate(config *configuration.UserConfig, reason uint) error {
+	messages := []string{}
+	for _, certConfig := range CertificateConfigs(config) {
+		err := revokeCertificate(certConfig, reason)
+		if err != nil {
+			messages = append(messages, fmt.Sprintf("%s: %v", certConfig.Filename, err))
+		}
+	}
+	if len(messages) > 0 {
+		return errors.New(strings.Join(messages, "; "))
+	}
+	return nil
+}
+
+func revokeCertificate(config *configuration.UserConfig, reason uint) error {
+	resource, err := loadResource(config)
+	if err != nil {
+		return err
+	}
+	return revokePEM(config, resource.Certificate, reason)
+}
+
+// Revoke a PEM encoded certificate
+func revokePEM(config *configuration.UserConfig, cert []byte, reason uint) error {
+	client, err := NewClient(*config)
+	if err != nil {
+		return err
+	}
+	start := time.Now()
+	err = client.Certificate.RevokeWithReason(cert, &reason)
+	observeOperation("revoke", start, err)
+	if err != nil {
+		return err
+	}
+	log.Infof("[%s] Certificate %s revoked with reason %d", config.Domains[0], config.Filename, reason)
+	return nil
+}
+
+// Load PEM encoded certificates in use, by filename.
+//
+// Certificates which cannot be loaded are omitted.
+func LoadCertificatesPEM(config *configuration.UserConfig) map[string][]byte {
+	certs := map[string][]byte{}
+	for _, certConfig := range CertificateConfigs(config) {
+		if resource, err := loadResource(certConfig); err == nil {
+			certs[certConfig.Filename] = resource.Certificate
+		}
+	}
+	return certs
+}
+
+// Revoke previous certificates, loaded using LoadCertificatesPEM, which were replaced since.
+//
+// Certificates which are still in use are never revoked. Return the number of
+// revoked certificates.
+func RevokeReplacedCertificates(config *configuration.UserConfig, previous map[string][]byte, reason uint) (int, error) {
+	revoked := 0
+	messages := []string{}
+	for _, certConfig := range CertificateConfigs(config) {
+		cert, ok := previous[certConfig.Filename]
+		if !ok {
+			continue
+		}
+		current, err := loadResource(certConfig)
+		if err != nil {
+			messages = append(messages, fmt.Sprintf("%s: %v", certConfig.Filename, err))
+			continue
+		}
+		if bytes.Equal(current.Certificate, cert) {
+			messages = append(messages, fmt.Sprintf("%s: certificate was not replaced, so it was not revoked", certConfig.Filename))
+			continue
+		}
+		if err := revokePEM(certConfig, cert, reason); err != nil {
+			messages = append(messages, fmt.Sprintf("%s: %v", certConfig.Filename, err))
+			continue
+		}
+		revoked += 1
+	}
+	if len(messages) > 0 {
+		return revoked, errors.New(strings.Join(messages, "; "))
+	}
+	return revoked, nil
+}
+
+// Get the name of a certificate chain, I.E, the common name of the issuer of the top certificate.
+//
+// This is the name used to select a preferred chain.
+func ChainName(issuer []byte) (string, error) {
+	certs, err := certcrypto.ParsePEMBundle(issuer)
+	if err != nil {
+		return "", err
+	}
+	return certs[len(certs)-1].Issuer.CommonName, nil
+}
+
+// Log which certificate chain was chosen
+func reportChain(resource *certificate.Resource, config configuration.UserConfig) {
+	chain, err := ChainName(resource.IssuerCertificate)
+	if err != nil {
+		log.Warnf("[%s] Failed to parse certificate chain: %v", resource.Domain, err)
+		return
+	}
+	if config.PreferredChain != "" && chain != config.PreferredChain {
+		log.Warnf("[%s] Preferred chain %q is not offered by CA, using chain %q instead", resource.Domain, config.PreferredChain, chain)
+		return
+	}
+	log.Infof("[%s] Using certificate chain %q", resource.Domain, chain)
+}
+
+// Load certificate resource saved in output directory
+func loadResource(config *configuration.UserConfig) (*certificate.Resource, error) {
+	certPath := filepath.Join(config.OutputDirectory, config.Filename+".crt")
+	keyPath := filepath.Join(config.OutputDirectory, config.Filename+".key")
+	issuerPath := filepath.Join(config.OutputDirectory, config.Filename+".issuer.crt")
+	metaPath := filepath.Join(config.OutputDirectory, config.Filename+".json")
+
+	resource := &certificate.Resource{}
+	// Metadata is optional, certificates saved by previous versions do not have it
+	if content, err := os.ReadFile(metaPath); err == nil {
+		err = json.Unmarshal(content, resource)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if resource.Domain == "" {
+		resource.Domain = config.Domains[0]
+	}
+	var err error
+	resource.Certificate, err = os.ReadFile(certPath)
+	if err != nil {
+		return nil, err
+	}
+	resource.PrivateKey, err = os.ReadFile(keyPath)
+	if err != nil {
+		return nil, err
+	}
+	resource.IssuerCertificate, err = os.ReadFile(issuerPath)
+	if err != nil {
+		return nil, err
+	}
+	return resource, nil
 }
 
 func saveResource(resource *certificate.Resource, config *configuration.UserConfig) error {
@@ -116,6 +336,7 @@ func saveResource(resource *certificate.Resource, config *configuration.UserConf
 	certPath := filepath.Join(config.OutputDirectory, config.Filename+".crt")
 	keyPath := filepath.Join(config.OutputDirectory, config.Filename+".key")
 	issuerPath := filepath.Join(config.OutputDirectory, config.Filename+".issuer.crt")
+	metaPath := filepath.Join(config.OutputDirectory, config.Filename+".json")
 
 	err := os.WriteFile(certPath, resource.Certificate, 0o600)
 	if err != nil {
@@ -129,6 +350,15 @@ func saveResource(resource *certificate.Resource, config *configuration.UserConf
 	if err != nil {
 		return err
 	}
+	// Write metadata (domain and certificate URLs) used on renewal
+	meta, err := json.MarshalIndent(resource, "", "  ")
+	if err != nil {
+		return err
+	}
+	err = os.WriteFile(metaPath, meta, 0o600)
+	if err != nil {
+		return err
+	}
 	return nil
 }
 
@@ -142,52 +372,142 @@ func readCert(filepath string) ([]*x509.Certificate, error) {
 	return certcrypto.ParsePEMBundle(content)
 }
 
-func needRenewal(x509Cert *x509.Certificate, days int) (bool, error) {
+// Read the certificate currently stored in output directory
+func ReadCertificate(config *configuration.UserConfig) (*x509.Certificate, error) {
+	cert, err := readCert(filepath.Join(config.OutputDirectory, config.Filename+".crt"))
+	if err != nil {
+		return nil, err
+	}
+	return cert[0], nil
+}
+
+// Check if a certificate must be renewed.
+//
+// A random time is picked once inside the renewal window of the certificate,
+// and certificate must be renewed once this time is reached.
+func needRenewal(x509Cert *x509.Certificate, config *configuration.UserConfig) (bool, error) {
 	if x509Cert.IsCA {
 		return false, errors.New("Certificate bundle starts with a CA certificate")
 	}
-	if days >= 0 {
-		notAfter := int(time.Until(x509Cert.NotAfter).Hours() / 24.0)
-		if notAfter > days {
-			return false, nil
-		}
+	window := GetRenewalWindow(config, x509Cert)
+	renewAt := renewalTime(config, x509Cert, window)
+	if time.Now().Before(renewAt) {
+		log.Infof("[%s] Certificate renewal window (%s) starts at %s. Renewal selected at %s.", x509Cert.Subject.CommonName, window.Source, window.Start.Format(time.RFC3339), renewAt.Format(time.RFC3339))
+		return false, nil
+	}
+	if window.ExplanationURL != "" {
+		log.Infof("[%s] CA requested early renewal: %s", x509Cert.Subject.CommonName, window.ExplanationURL)
 	}
-
 	return true, nil
 }
 
-func GetOrRenewCertificate(config *configuration.UserConfig, days int) (bool, error) {
+// Names of key types, used as filename suffixes in hybrid mode
+var keyTypeNames = map[certcrypto.KeyType]string{
+	certcrypto.RSA2048: constants.KEY_TYPE_RSA2048,
+	certcrypto.RSA4096: constants.KEY_TYPE_RSA4096,
+	certcrypto.RSA8192: constants.KEY_TYPE_RSA8192,
+	certcrypto.EC256:   constants.KEY_TYPE_EC256,
+	certcrypto.EC384:   constants.KEY_TYPE_EC384,
+}
+
+// Get configuration of each certificate managed for user.
+//
+// The first configuration is the primary certificate, stored under FILENAME.
+// In hybrid mode, an additional certificate is managed for each additional
+// key type, and stored under FILENAME.<key type> (e.g. example.com.ec256.crt).
+func CertificateConfigs(config *configuration.UserConfig) []*configuration.UserConfig {
+	configs := []*configuration.UserConfig{config}
+	for _, keyType := range config.AdditionalKeyTypes {
+		additional := *config
+		additional.CADirKeyType = keyType
+		additional.AdditionalKeyTypes = nil
+		additional.Filename = config.Filename + "." + strings.ToLower(keyTypeNames[keyType])
+		configs = append(configs, &additional)
+	}
+	return configs
+}
+
+// Get certificates from output directory, or request new certificates
+// when they do not exist or when they must be renewed.
+//
+// In hybrid mode, a certificate is managed for each key type.
+// Return true when at least one new certificate was saved.
+func GetOrRenewCertificate(config *configuration.UserConfig) (bool, error) {
+	return getOrRenewCertificates(config, false)
+}
+
+// Renew certificates, even when renewal is not due yet
+func ForceRenewCertificate(config *configuration.UserConfig) (bool, error) {
+	return getOrRenewCertificates(config, true)
+}
+
+func getOrRenewCertificates(config *configuration.UserConfig, force bool) (bool, error) {
+	renewed := false
+	messages := []string{}
+	for _, certConfig := range CertificateConfigs(config) {
+		ok, err := getOrRenewCertificate(certConfig, force)
+		if err != nil {
+			messages = append(messages, fmt.Sprintf("%s: %v", certConfig.Filename, err))
+			notifyFailed(certConfig, err)
+		}
+		notifyExpiry(certConfig)
+		renewed = renewed || ok
+	}
+	if len(messages) > 0 {
+		return renewed, errors.New(strings.Join(messages, "; "))
+	}
+	return renewed, nil
+}
+
+func getOrRenewCertificate(config *configuration.UserConfig, force bool) (bool, error) {
 	filepath := filepath.Join(config.OutputDirectory, config.Filename+".crt")
 	cert, err := readCert(filepath)
 	if err != nil {
-		resource, requestErr := RequestCertificate(*config)
-		if requestErr != nil {
-			return false, requestErr
-		}
-		err = saveResource(resource, config)
-		if err != nil {
-			return false, err
-		}
-		return true, err
+		// Request a new certificate
+		return requestAndInstall(config, constants.EVENT_ISSUED, func() (*certificate.Resource, error) {
+			return RequestCertificate(*config)
+		})
 	}
-	x509Cert := cert[0]
-	if x509Cert.IsCA {
-		return false, errors.New("Certificate bundle starts with a CA certificate")
+	// Request a new certificate when existing certificate does not match configuration
+	if err := CheckCertificateMatch(cert[0], config); err != nil {
+		log.Warnf("[%s] Existing certificate does not match configuration (%v), requesting a new certificate", config.Domains[0], err)
+		return requestAndInstall(config, constants.EVENT_ISSUED, func() (*certificate.Resource, error) {
+			return RequestCertificate(*config)
+		})
 	}
-	if days >= 0 {
-		notAfter := int(time.Until(x509Cert.NotAfter).Hours() / 24.0)
-		if notAfter > days {
-			return false, nil
-		}
-		resource, err := RequestCertificate(*config)
-		if err != nil {
+	if force {
+		log.Infof("[%s] Forcing certificate renewal", config.Domains[0])
+	} else {
+		renew, err := needRenewal(cert[0], config)
+		if err != nil || !renew {
 			return false, err
 		}
-		err = saveResource(resource, config)
+	}
+	// Renew existing certificate, or request a new one when existing resource cannot be loaded
+	return requestAndInstall(config, constants.EVENT_RENEWED, func() (*certificate.Resource, error) {
+		existing, err := loadResource(config)
 		if err != nil {
-			return false, err
+			log.Warnf("[%s] Failed to load existing certificate, requesting a new one: %v", config.Domains[0], err)
+			return RequestCertificate(*config)
 		}
-		return true, nil
+		return RenewCertificate(*config, existing)
+	})
+}
+
+// Request a certificate using request, then install it and notify an event of type eventType.
+//
+// Attempts and failures are recorded in metrics. Return whether a certificate was installed.
+func requestAndInstall(config *configuration.UserConfig, eventType string, request func() (*certificate.Resource, error)) (bool, error) {
+	renewalAttempts.Inc(config.Filename)
+	resource, err := request()
+	if err != nil {
+		renewalFailures.Inc(config.Filename, requestFailureReason(err))
+		return false, err
 	}
-	return false, nil
+	if err := installResource(resource, config); err != nil {
+		renewalFailures.Inc(config.Filename, "install")
+		return false, err
+	}
+	notifyInstalled(eventType, resource.Certificate, config)
+	return true, nil
 }
@@ -0,0 +1,154 @@
+package acme
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/go-acme/lego/v4/certcrypto"
+	"github.com/go-acme/lego/v4/certificate"
+
+	"github.com/quara-dev/letsgo-nats/configuration"
+)
+
+// Generate a self-signed certificate used in tests
+func newTestCertificate(t *testing.T, notBefore time.Time, notAfter time.Time, domains ...string) *x509.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	template := &x509.Certificate{
+		SerialNumber:   big.NewInt(0x87654321),
+		Subject:        pkix.Name{CommonName: domains[0]},
+		DNSNames:       domains,
+		NotBefore:      notBefore,
+		NotAfter:       notAfter,
+		AuthorityKeyId: []byte{0x69, 0x88, 0x5B, 0x6B, 0x87, 0x46, 0x40, 0x41, 0xE1, 0xB3, 0x7B, 0x84, 0x7B, 0xA0, 0xAE, 0x2C, 0xDE, 0x01, 0xC8, 0xD4},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	return cert
+}
+
+// Test that saved certificate resources can be loaded for renewal
+func TestSaveAndLoadResource(t *testing.T) {
+	config := &configuration.UserConfig{
+		OutputDirectory: t.TempDir(),
+		Filename:        "example.com",
+		Domains:         []string{"example.com"},
+	}
+	resource := &certificate.Resource{
+		Domain:            "example.com",
+		CertURL:           "https://ca/cert/1",
+		CertStableURL:     "https://ca/cert/1",
+		Certificate:       []byte("certificate"),
+		PrivateKey:        []byte("key"),
+		IssuerCertificate: []byte("issuer"),
+	}
+	err := saveResource(resource, config)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	loaded, err := loadResource(config)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if loaded.CertURL != resource.CertURL || loaded.Domain != resource.Domain {
+		t.Errorf("Metadata was not loaded: %+v", loaded)
+	}
+	if string(loaded.Certificate) != "certificate" || string(loaded.PrivateKey) != "key" || string(loaded.IssuerCertificate) != "issuer" {
+		t.Errorf("Certificate files were not loaded: %+v", loaded)
+	}
+}
+
+// Test that an additional certificate is managed for each additional key type
+func TestCertificateConfigs(t *testing.T) {
+	config := &configuration.UserConfig{
+		Filename:           "example.com",
+		CADirKeyType:       certcrypto.RSA2048,
+		AdditionalKeyTypes: []certcrypto.KeyType{certcrypto.EC256},
+	}
+	configs := CertificateConfigs(config)
+	if len(configs) != 2 {
+		t.Fatalf("Expected 2 certificates but got %d", len(configs))
+	}
+	if configs[0].Filename != "example.com" || configs[0].CADirKeyType != certcrypto.RSA2048 {
+		t.Errorf("Bad primary certificate: %s (%s)", configs[0].Filename, configs[0].CADirKeyType)
+	}
+	if configs[1].Filename != "example.com.ec256" || configs[1].CADirKeyType != certcrypto.EC256 {
+		t.Errorf("Bad additional certificate: %s (%s)", configs[1].Filename, configs[1].CADirKeyType)
+	}
+}
+
+// Test that ECDSA keys saved by lego can be loaded as TLS key pairs, just like NATS does
+func TestECDSAKeyPair(t *testing.T) {
+	for _, keyType := range []certcrypto.KeyType{certcrypto.EC256, certcrypto.EC384} {
+		key, err := certcrypto.GeneratePrivateKey(keyType)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		template := &x509.Certificate{
+			SerialNumber: big.NewInt(1),
+			Subject:      pkix.Name{CommonName: "example.com"},
+			DNSNames:     []string{"example.com"},
+			NotBefore:    time.Now(),
+			NotAfter:     time.Now().Add(time.Hour),
+		}
+		der, err := x509.CreateCertificate(rand.Reader, template, template, key.(crypto.Signer).Public(), key)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+		_, err = tls.X509KeyPair(certPEM, certcrypto.PEMEncode(key))
+		if err != nil {
+			t.Errorf("Failed to load %s key pair: %v", keyType, err)
+		}
+	}
+}
+
+// Test that chain name is the common name of the issuer of the top certificate
+func TestChainName(t *testing.T) {
+	root := newTestCertificate(t, time.Now(), time.Now().Add(time.Hour), "ISRG Root X1")
+	bundle := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: root.Raw})
+	got, err := ChainName(bundle)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if got != "ISRG Root X1" {
+		t.Errorf("got %q, wanted %q", got, "ISRG Root X1")
+	}
+}
+
+func TestParseRevocationReason(t *testing.T) {
+	for value, want := range map[string]uint{"superseded": 4, "KeyCompromise": 1, "0": 0, "5": 5} {
+		reason, err := ParseRevocationReason(value)
+		if err != nil {
+			t.Errorf(err.Error())
+		}
+		if reason != want {
+			t.Errorf("Bad revocation reason for %s. Want: %d. Got: %d", value, want, reason)
+		}
+	}
+	_, err := ParseRevocationReason("2")
+	err_want := "Invalid revocation reason: 2. Allowed values are 'affiliationChanged', 'cessationOfOperation', 'keyCompromise', 'superseded', 'unspecified'."
+	if err == nil {
+		t.Fatalf("Expected error. Want: %s. Got: nil", err_want)
+	}
+	if err.Error() != err_want {
+		t.Errorf("Bad error. Want: %s. Got: %s", err_want, err.Error())
+	}
+}
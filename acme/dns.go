@@ -0,0 +1,57 @@
+package acme
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/go-acme/lego/v4/challenge"
+
+	"github.com/quara-dev/letsgo-nats/configuration"
+)
+
+// Function used to create a DNS-01 challenge provider from user configuration
+type DNSProviderFactory func(userConfig configuration.UserConfig) (challenge.Provider, error)
+
+// DNS provider which can be used to solve DNS-01 challenges
+//
+// Each provider declares the credentials it needs. Credentials are
+// resolved by the configuration package and are available to the
+// factory through UserConfig.DNSCredentials.
+type DNSProvider struct {
+	Name        string
+	Credentials []configuration.DNSCredential
+	New         DNSProviderFactory
+}
+
+// Registered DNS providers, indexed by name
+var dnsProviders = map[string]DNSProvider{}
+
+// Register a DNS provider.
+//
+// Providers register themselves in init functions, and are only compiled
+// in when their build tag is enabled.
+func RegisterDNSProvider(provider DNSProvider) {
+	dnsProviders[provider.Name] = provider
+	configuration.RegisterDNSCredentials(provider.Name, provider.Credentials...)
+}
+
+// Names of registered DNS providers
+func DNSProviders() []string {
+	names := []string{}
+	for name := range dnsProviders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Create the DNS-01 challenge provider configured by user
+func newDNSProvider(userConfig configuration.UserConfig) (challenge.Provider, error) {
+	provider, ok := dnsProviders[userConfig.DNSProvider]
+	if !ok {
+		return nil, errors.New(fmt.Sprintf("Invalid DNS provider: %s. Available providers are: %s", userConfig.DNSProvider, strings.Join(DNSProviders(), ", ")))
+	}
+	return provider.New(userConfig)
+}
@@ -0,0 +1,33 @@
+//go:build cloudflare
+
+package acme
+
+import (
+	"github.com/go-acme/lego/v4/challenge"
+	"github.com/go-acme/lego/v4/providers/dns/cloudflare"
+
+	"github.com/quara-dev/letsgo-nats/configuration"
+	"github.com/quara-dev/letsgo-nats/constants"
+)
+
+// Cloudflare DNS provider is compiled in when the cloudflare build tag is set
+func init() {
+	RegisterDNSProvider(DNSProvider{
+		Name: constants.DNS_PROVIDER_CLOUDFLARE,
+		Credentials: []configuration.DNSCredential{
+			{Name: "API_TOKEN", DefaultSecret: "cf-api-token"},
+			{Name: "ZONE_TOKEN", DefaultSecret: "cf-zone-token", Optional: true},
+		},
+		New: newCloudflareProvider,
+	})
+}
+
+func newCloudflareProvider(userConfig configuration.UserConfig) (challenge.Provider, error) {
+	// Generate Cloudflare provider configuration
+	providerConfig := cloudflare.NewDefaultConfig()
+	// Set API tokens from user config
+	providerConfig.AuthToken = userConfig.DNSCredentials["API_TOKEN"]
+	providerConfig.ZoneToken = userConfig.DNSCredentials["ZONE_TOKEN"]
+	// Create Cloudflare DNS Provider
+	return cloudflare.NewDNSProviderConfig(providerConfig)
+}
@@ -0,0 +1,35 @@
+//go:build !no_digitalocean
+
+package acme
+
+import (
+	"time"
+
+	"github.com/go-acme/lego/v4/challenge"
+	"github.com/go-acme/lego/v4/providers/dns/digitalocean"
+
+	"github.com/quara-dev/letsgo-nats/configuration"
+	"github.com/quara-dev/letsgo-nats/constants"
+)
+
+// DigitalOcean DNS provider is compiled in unless the no_digitalocean build tag is set
+func init() {
+	RegisterDNSProvider(DNSProvider{
+		Name: constants.DNS_PROVIDER_DIGITALOCEAN,
+		Credentials: []configuration.DNSCredential{
+			{Name: "AUTH_TOKEN", DefaultSecret: constants.DEFAULT_DNS_AUTH_TOKEN_SECRET},
+		},
+		New: newDigitalOceanProvider,
+	})
+}
+
+func newDigitalOceanProvider(userConfig configuration.UserConfig) (challenge.Provider, error) {
+	// Generate DigitalOcean provider configuration
+	providerConfig := digitalocean.NewDefaultConfig()
+	// Set auth token from user config
+	providerConfig.AuthToken = userConfig.DNSCredentials["AUTH_TOKEN"]
+	// Use a propagation timeout of 1 minute and 30 seconds
+	providerConfig.PropagationTimeout = time.Duration(time.Second * 90)
+	// Create DigitalOcean DNS Provider
+	return digitalocean.NewDNSProviderConfig(providerConfig)
+}
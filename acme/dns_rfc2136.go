@@ -0,0 +1,39 @@
+//go:build rfc2136
+
+package acme
+
+import (
+	"github.com/go-acme/lego/v4/challenge"
+	"github.com/go-acme/lego/v4/providers/dns/rfc2136"
+
+	"github.com/quara-dev/letsgo-nats/configuration"
+	"github.com/quara-dev/letsgo-nats/constants"
+)
+
+// RFC2136 DNS provider is compiled in when the rfc2136 build tag is set
+func init() {
+	RegisterDNSProvider(DNSProvider{
+		Name: constants.DNS_PROVIDER_RFC2136,
+		Credentials: []configuration.DNSCredential{
+			{Name: "NAMESERVER"},
+			{Name: "TSIG_KEY", Optional: true},
+			{Name: "TSIG_SECRET", DefaultSecret: "tsig-secret", Optional: true},
+			{Name: "TSIG_ALGORITHM", Optional: true},
+		},
+		New: newRFC2136Provider,
+	})
+}
+
+func newRFC2136Provider(userConfig configuration.UserConfig) (challenge.Provider, error) {
+	// Generate RFC2136 provider configuration
+	providerConfig := rfc2136.NewDefaultConfig()
+	// Set nameserver and TSIG options from user config
+	providerConfig.Nameserver = userConfig.DNSCredentials["NAMESERVER"]
+	providerConfig.TSIGKey = userConfig.DNSCredentials["TSIG_KEY"]
+	providerConfig.TSIGSecret = userConfig.DNSCredentials["TSIG_SECRET"]
+	if algorithm, ok := userConfig.DNSCredentials["TSIG_ALGORITHM"]; ok {
+		providerConfig.TSIGAlgorithm = algorithm
+	}
+	// Create RFC2136 DNS Provider
+	return rfc2136.NewDNSProviderConfig(providerConfig)
+}
@@ -0,0 +1,129 @@
+package acme
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"github.com/go-acme/lego/v4/certcrypto"
+
+	"github.com/quara-dev/letsgo-nats/configuration"
+	"github.com/quara-dev/letsgo-nats/constants"
+)
+
+// Remaining days of validity which trigger an expiring event, from highest to lowest
+var EXPIRY_THRESHOLDS = []int{30, 14, 7, 1}
+
+// Event emitted when a certificate is issued, renewed, fails to be renewed, or is about to expire
+type CertificateEvent struct {
+	Type          string     `json:"type"`
+	Time          time.Time  `json:"time"`
+	Filename      string     `json:"filename"`
+	Domains       []string   `json:"domains"`
+	Fingerprint   string     `json:"fingerprint,omitempty"`
+	NotBefore     *time.Time `json:"not_before,omitempty"`
+	NotAfter      *time.Time `json:"not_after,omitempty"`
+	ThresholdDays int        `json:"threshold_days,omitempty"`
+	Error         string     `json:"error,omitempty"`
+}
+
+var (
+	eventsMu     sync.Mutex
+	eventHandler func(CertificateEvent)
+	// Lowest expiry threshold already notified, by certificate fingerprint
+	expiryNotified = map[string]int{}
+)
+
+// Register a function called for each certificate lifecycle event
+func OnCertificateEvent(handler func(CertificateEvent)) {
+	eventsMu.Lock()
+	defer eventsMu.Unlock()
+	eventHandler = handler
+}
+
+// Get the SHA-256 fingerprint of a certificate, as an hexadecimal string
+func Fingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return hex.EncodeToString(sum[:])
+}
+
+// Create an event for a certificate, or for configured domains when certificate is nil
+func newCertificateEvent(eventType string, config *configuration.UserConfig, cert *x509.Certificate) CertificateEvent {
+	event := CertificateEvent{
+		Type:     eventType,
+		Time:     time.Now().UTC(),
+		Filename: config.Filename,
+		Domains:  config.Domains,
+	}
+	if cert != nil {
+		event.Domains = certcrypto.ExtractDomains(cert)
+		event.Fingerprint = Fingerprint(cert)
+		event.NotBefore = &cert.NotBefore
+		event.NotAfter = &cert.NotAfter
+	}
+	return event
+}
+
+// Send an event to registered handler
+func emitEvent(event CertificateEvent) {
+	eventsMu.Lock()
+	handler := eventHandler
+	eventsMu.Unlock()
+	if handler != nil {
+		handler(event)
+	}
+}
+
+// Emit an event for an installed certificate
+func notifyInstalled(eventType string, resource []byte, config *configuration.UserConfig) {
+	cert, _ := certcrypto.ParsePEMCertificate(resource)
+	emitEvent(newCertificateEvent(eventType, config, cert))
+}
+
+// Emit an event for a failed certificate request, including the current certificate when it exists
+func notifyFailed(config *configuration.UserConfig, failure error) {
+	cert, _ := ReadCertificate(config)
+	event := newCertificateEvent(constants.EVENT_FAILED, config, cert)
+	event.Error = failure.Error()
+	emitEvent(event)
+}
+
+// Get the lowest expiry threshold reached by a certificate, or 0 when no threshold is reached
+func expiryThreshold(cert *x509.Certificate, now time.Time) int {
+	reached := 0
+	remaining := cert.NotAfter.Sub(now)
+	for _, days := range EXPIRY_THRESHOLDS {
+		if remaining <= time.Duration(days)*24*time.Hour {
+			reached = days
+		}
+	}
+	return reached
+}
+
+// Emit an event when current certificate crosses an expiry threshold.
+//
+// Each threshold is notified once per certificate.
+func notifyExpiry(config *configuration.UserConfig) {
+	cert, err := ReadCertificate(config)
+	if err != nil {
+		return
+	}
+	threshold := expiryThreshold(cert, time.Now())
+	if threshold == 0 {
+		return
+	}
+	fingerprint := Fingerprint(cert)
+	eventsMu.Lock()
+	notified, ok := expiryNotified[fingerprint]
+	if ok && notified <= threshold {
+		eventsMu.Unlock()
+		return
+	}
+	expiryNotified[fingerprint] = threshold
+	eventsMu.Unlock()
+	event := newCertificateEvent(constants.EVENT_EXPIRING, config, cert)
+	event.ThresholdDays = threshold
+	emitEvent(event)
+}
@@ -0,0 +1,56 @@
+package acme
+
+import (
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/quara-dev/letsgo-nats/configuration"
+	"github.com/quara-dev/letsgo-nats/constants"
+)
+
+func TestExpiryThreshold(t *testing.T) {
+	now := time.Now()
+	for remaining, want := range map[time.Duration]int{
+		60 * 24 * time.Hour: 0,
+		30 * 24 * time.Hour: 30,
+		5 * 24 * time.Hour:  7,
+		12 * time.Hour:      1,
+		-time.Hour:          1,
+	} {
+		cert := newTestCertificate(t, now.Add(-time.Hour), now.Add(remaining), "example.com")
+		threshold := expiryThreshold(cert, now)
+		if threshold != want {
+			t.Errorf("Bad expiry threshold for %s. Want: %d. Got: %d", remaining, want, threshold)
+		}
+	}
+}
+
+func TestNotifyExpiry(t *testing.T) {
+	dir := t.TempDir()
+	config := &configuration.UserConfig{Domains: []string{"example.com"}, Filename: "example.com", OutputDirectory: dir}
+	cert := newTestCertificate(t, time.Now(), time.Now().Add(5*24*time.Hour), "example.com")
+	err := os.WriteFile(filepath.Join(dir, "example.com.crt"), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}), 0o600)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	events := []CertificateEvent{}
+	OnCertificateEvent(func(event CertificateEvent) {
+		events = append(events, event)
+	})
+	defer OnCertificateEvent(nil)
+
+	notifyExpiry(config)
+	notifyExpiry(config)
+	if len(events) != 1 {
+		t.Fatalf("Bad number of events. Want: 1. Got: %d", len(events))
+	}
+	if events[0].Type != constants.EVENT_EXPIRING || events[0].ThresholdDays != 7 {
+		t.Errorf("Bad event. Want: %s with threshold 7. Got: %s with threshold %d", constants.EVENT_EXPIRING, events[0].Type, events[0].ThresholdDays)
+	}
+	if events[0].Fingerprint != Fingerprint(cert) || !events[0].NotAfter.Equal(cert.NotAfter) {
+		t.Errorf("Bad event certificate. Want: %s. Got: %s", Fingerprint(cert), events[0].Fingerprint)
+	}
+}
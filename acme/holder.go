@@ -0,0 +1,74 @@
+package acme
+
+import (
+	"crypto/tls"
+	"errors"
+	"sync/atomic"
+
+	"github.com/quara-dev/letsgo-nats/configuration"
+)
+
+// Holder of certificates served by TLS listeners.
+//
+// Certificates are swapped atomically, so that new certificates are used on
+// the next TLS handshake, without reloading NATS server configuration.
+type CertificateHolder struct {
+	config *configuration.UserConfig
+	certs  atomic.Pointer[[]tls.Certificate]
+}
+
+// Create a new certificate holder and load certificates managed for user
+func NewCertificateHolder(config *configuration.UserConfig) (*CertificateHolder, error) {
+	holder := &CertificateHolder{config: config}
+	err := holder.Reload()
+	if err != nil {
+		return nil, err
+	}
+	return holder, nil
+}
+
+// Load certificates from output directory.
+//
+// Certificates in use are kept when certificates cannot be loaded.
+func (h *CertificateHolder) Reload() error {
+	certs, err := LoadCertificates(h.config)
+	if err != nil {
+		return err
+	}
+	h.certs.Store(&certs)
+	return nil
+}
+
+// Get certificates in use
+func (h *CertificateHolder) Certificates() []tls.Certificate {
+	return *h.certs.Load()
+}
+
+// Check that certificates in use are currently valid
+func (h *CertificateHolder) Check() error {
+	return checkValidity(h.Certificates())
+}
+
+// Select the first certificate supported by peer, or the first certificate when none is supported
+func (h *CertificateHolder) selectCertificate(supports func(*tls.Certificate) error) (*tls.Certificate, error) {
+	certs := h.Certificates()
+	if len(certs) == 0 {
+		return nil, errors.New("no certificate available")
+	}
+	for i := range certs {
+		if supports(&certs[i]) == nil {
+			return &certs[i], nil
+		}
+	}
+	return &certs[0], nil
+}
+
+// Implements tls.Config.GetCertificate
+func (h *CertificateHolder) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return h.selectCertificate(hello.SupportsCertificate)
+}
+
+// Implements tls.Config.GetClientCertificate, used by outgoing leafnode and gateway connections
+func (h *CertificateHolder) GetClientCertificate(request *tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	return h.selectCertificate(request.SupportsCertificate)
+}
@@ -0,0 +1,66 @@
+package acme
+
+import (
+	"bytes"
+	"crypto/tls"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/quara-dev/letsgo-nats/configuration"
+)
+
+// Test that renewed certificates are served once holder is reloaded
+func TestCertificateHolderReload(t *testing.T) {
+	config := &configuration.UserConfig{
+		OutputDirectory: t.TempDir(),
+		Filename:        "example.com",
+		Domains:         []string{"example.com"},
+	}
+	err := saveResource(newTestResource(t, "example.com"), config)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	holder, err := NewCertificateHolder(config)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if err := holder.Check(); err != nil {
+		t.Errorf(err.Error())
+	}
+	previous, err := holder.GetCertificate(&tls.ClientHelloInfo{ServerName: "example.com"})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	err = saveResource(newTestResource(t, "example.com"), config)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	err = holder.Reload()
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	renewed, err := holder.GetCertificate(&tls.ClientHelloInfo{ServerName: "example.com"})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if bytes.Equal(previous.Leaf.Raw, renewed.Leaf.Raw) {
+		t.Errorf("Renewed certificate is not served")
+	}
+	// Certificates in use are kept when certificates cannot be loaded
+	err = os.Remove(filepath.Join(config.OutputDirectory, "example.com.key"))
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	err = holder.Reload()
+	if err == nil {
+		t.Errorf("Missing private key was not detected")
+	}
+	current, err := holder.GetCertificate(&tls.ClientHelloInfo{ServerName: "example.com"})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if !bytes.Equal(current.Leaf.Raw, renewed.Leaf.Raw) {
+		t.Errorf("Certificate in use was not kept")
+	}
+}
@@ -0,0 +1,99 @@
+package acme
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-acme/lego/v4/challenge/http01"
+	"github.com/go-acme/lego/v4/log"
+)
+
+// In-process solver for HTTP-01 challenges
+//
+// Implements challenge.Provider. The listener is started when the first
+// challenge is presented, and shut down once all pending challenges are
+// cleaned up, so the address is only bound while an order is pending.
+type HTTP01Solver struct {
+	Address string
+
+	mu       sync.Mutex
+	tokens   map[string]http01Token
+	server   *http.Server
+	listener net.Listener
+}
+
+type http01Token struct {
+	domain  string
+	keyAuth string
+}
+
+// Create a new HTTP-01 solver listening on given address
+func NewHTTP01Solver(address string) *HTTP01Solver {
+	return &HTTP01Solver{Address: address, tokens: map[string]http01Token{}}
+}
+
+// Make the key authorization available and start listener if needed
+func (s *HTTP01Solver) Present(domain, token, keyAuth string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.listener == nil {
+		listener, err := net.Listen("tcp", s.Address)
+		if err != nil {
+			return errors.New("Could not start HTTP server for challenge: " + err.Error())
+		}
+		s.listener = listener
+		s.server = &http.Server{Handler: s, ReadHeaderTimeout: 10 * time.Second}
+		// We don't want any lingering connections once server is shut down
+		s.server.SetKeepAlivesEnabled(false)
+		go s.server.Serve(listener)
+	}
+	s.tokens[token] = http01Token{domain: domain, keyAuth: keyAuth}
+	return nil
+}
+
+// Remove the key authorization and stop listener when no challenge is pending
+func (s *HTTP01Solver) CleanUp(domain, token, keyAuth string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.tokens, token)
+	if len(s.tokens) > 0 || s.server == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err := s.server.Shutdown(ctx)
+	s.server = nil
+	s.listener = nil
+	return err
+}
+
+// Serve key authorizations of pending challenges
+func (s *HTTP01Solver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	token := strings.TrimPrefix(r.URL.Path, http01.ChallengePath(""))
+	s.mu.Lock()
+	challenge, ok := s.tokens[token]
+	s.mu.Unlock()
+	// Only respond to GET requests whose host matches the challenge domain
+	// to prevent DNS rebind attacks.
+	if !ok || r.Method != http.MethodGet || !strings.EqualFold(requestHost(r), challenge.domain) {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain")
+	w.Write([]byte(challenge.keyAuth))
+	log.Infof("[%s] Served key authentication", challenge.domain)
+}
+
+// Get host of a request without port
+func requestHost(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.Host)
+	if err != nil {
+		return r.Host
+	}
+	return host
+}
@@ -0,0 +1,52 @@
+package acme
+
+import (
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/go-acme/lego/v4/challenge/http01"
+)
+
+// Test that HTTP-01 solver only listens while challenges are pending
+func TestHTTP01SolverLifecycle(t *testing.T) {
+	solver := NewHTTP01Solver("127.0.0.1:0")
+	err := solver.Present("localhost", "token", "keyAuth")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	address := solver.listener.Addr().String()
+
+	req, _ := http.NewRequest(http.MethodGet, "http://"+address+http01.ChallengePath("token"), nil)
+	req.Host = "localhost"
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "keyAuth" {
+		t.Errorf("got %q, wanted %q", string(body), "keyAuth")
+	}
+
+	resp, err = http.Get("http://" + address + http01.ChallengePath("unknown"))
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected status 404 for unknown token but got %d", resp.StatusCode)
+	}
+
+	err = solver.CleanUp("localhost", "token", "keyAuth")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if solver.listener != nil {
+		t.Errorf("Listener should be closed once all challenges are cleaned up")
+	}
+	_, err = http.Get("http://" + address + http01.ChallengePath("token"))
+	if err == nil {
+		t.Errorf("Expected connection error once listener is closed")
+	}
+}
@@ -0,0 +1,424 @@
+package acme
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-acme/lego/v4/certcrypto"
+	"github.com/go-acme/lego/v4/certificate"
+	"github.com/go-acme/lego/v4/log"
+
+	"github.com/quara-dev/letsgo-nats/configuration"
+)
+
+// Directory holding one sub-directory per certificate version, under output directory
+const VERSIONS_DIRECTORY = "versions"
+
+// Symlink to the version in use, under output directory
+const CURRENT_LINK = "current"
+
+// Symlink to the version in use before last installation, kept until new certificates are committed
+const PREVIOUS_LINK = "previous"
+
+// Layout used to name versions. Names sort in chronological order.
+const VERSION_LAYOUT = "20060102T150405.000000000Z"
+
+// Names of files written for a certificate
+func resourceFiles(config *configuration.UserConfig) []string {
+	return []string{
+		config.Filename + ".crt",
+		config.Filename + ".key",
+		config.Filename + ".issuer.crt",
+		config.Filename + ".json",
+	}
+}
+
+// Check that a certificate resource can be installed.
+//
+// The private key must match the certificate, and the certificate chain
+// must verify up to the issuer certificate for the configured domains.
+func ValidateResource(resource *certificate.Resource, config *configuration.UserConfig) error {
+	// Check that private key matches certificate
+	_, err := tls.X509KeyPair(resource.Certificate, resource.PrivateKey)
+	if err != nil {
+		return errors.New(fmt.Sprintf("invalid key pair: %v", err))
+	}
+	bundle, err := certcrypto.ParsePEMBundle(resource.Certificate)
+	if err != nil {
+		return errors.New(fmt.Sprintf("invalid certificate: %v", err))
+	}
+	// Verify chain up to issuer certificate
+	issuers := x509.NewCertPool()
+	for _, cert := range bundle[1:] {
+		issuers.AddCert(cert)
+	}
+	if len(resource.IssuerCertificate) > 0 {
+		issuerCerts, err := certcrypto.ParsePEMBundle(resource.IssuerCertificate)
+		if err != nil {
+			return errors.New(fmt.Sprintf("invalid issuer certificate: %v", err))
+		}
+		for _, cert := range issuerCerts {
+			issuers.AddCert(cert)
+		}
+	}
+	for _, domain := range config.Domains {
+		_, err = bundle[0].Verify(x509.VerifyOptions{
+			DNSName:   domain,
+			Roots:     issuers,
+			KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+		})
+		if err != nil {
+			return errors.New(fmt.Sprintf("invalid certificate chain: %v", err))
+		}
+	}
+	return nil
+}
+
+// Validate installed certificates of all certificates managed for user, like before install
+func ValidateInstalledCertificates(config *configuration.UserConfig) error {
+	for _, certConfig := range CertificateConfigs(config) {
+		resource, err := loadResource(certConfig)
+		if err != nil {
+			return err
+		}
+		err = ValidateResource(resource, certConfig)
+		if err != nil {
+			return errors.New(fmt.Sprintf("%s: %v", certConfig.Filename, err))
+		}
+	}
+	return nil
+}
+
+// Atomically replace a symlink (or a regular file) with a symlink to target
+func swapLink(target string, link string) error {
+	tmp := link + ".tmp"
+	err := os.Remove(tmp)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	err = os.Symlink(target, tmp)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, link)
+}
+
+// Get the name of the version a symlink points to, or an empty string when symlink does not exist
+func linkedVersion(link string) (string, error) {
+	target, err := os.Readlink(link)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return filepath.Base(target), nil
+}
+
+// Copy files of a directory into another directory
+func copyFiles(source string, destination string) error {
+	entries, err := os.ReadDir(source)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() {
+			continue
+		}
+		content, err := os.ReadFile(filepath.Join(source, entry.Name()))
+		if err != nil {
+			return err
+		}
+		err = os.WriteFile(filepath.Join(destination, entry.Name()), content, 0o600)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Create a new version directory, atomically.
+//
+// The new version holds the files of the current version, and the files written by write.
+func createVersion(outputDirectory string, write func(dir string) error) (string, error) {
+	versionsDir := filepath.Join(outputDirectory, VERSIONS_DIRECTORY)
+	err := os.MkdirAll(versionsDir, 0o700)
+	if err != nil {
+		return "", err
+	}
+	version := time.Now().UTC().Format(VERSION_LAYOUT)
+	tmp := filepath.Join(versionsDir, "."+version)
+	err = os.Mkdir(tmp, 0o700)
+	if err != nil {
+		return "", err
+	}
+	// Keep files of other certificates (hybrid mode) from current version
+	current := filepath.Join(outputDirectory, CURRENT_LINK)
+	if _, err := os.Stat(current); err == nil {
+		err = copyFiles(current, tmp)
+		if err != nil {
+			os.RemoveAll(tmp)
+			return "", err
+		}
+	}
+	err = write(tmp)
+	if err != nil {
+		os.RemoveAll(tmp)
+		return "", err
+	}
+	err = os.Rename(tmp, filepath.Join(versionsDir, version))
+	if err != nil {
+		os.RemoveAll(tmp)
+		return "", err
+	}
+	return version, nil
+}
+
+// Import certificate files written by previous releases directly in output directory
+func importLegacyFiles(config *configuration.UserConfig) error {
+	legacy := []string{}
+	for _, name := range resourceFiles(config) {
+		info, err := os.Lstat(filepath.Join(config.OutputDirectory, name))
+		if err == nil && info.Mode().IsRegular() {
+			legacy = append(legacy, name)
+		}
+	}
+	if len(legacy) == 0 {
+		return nil
+	}
+	version, err := createVersion(config.OutputDirectory, func(dir string) error {
+		for _, name := range legacy {
+			content, err := os.ReadFile(filepath.Join(config.OutputDirectory, name))
+			if err != nil {
+				return err
+			}
+			err = os.WriteFile(filepath.Join(dir, name), content, 0o600)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return swapLink(filepath.Join(VERSIONS_DIRECTORY, version), filepath.Join(config.OutputDirectory, CURRENT_LINK))
+}
+
+// Validate a certificate resource and install it as a new version in output directory.
+//
+// The version in use before installation is kept as previous version until
+// CommitCertificate or RestoreCertificate is called.
+func installResource(resource *certificate.Resource, config *configuration.UserConfig) error {
+	err := ValidateResource(resource, config)
+	if err != nil {
+		return errors.New(fmt.Sprintf("Refusing to install certificate: %v", err))
+	}
+	current := filepath.Join(config.OutputDirectory, CURRENT_LINK)
+	previous := filepath.Join(config.OutputDirectory, PREVIOUS_LINK)
+	currentVersion, err := linkedVersion(current)
+	if err != nil {
+		return err
+	}
+	if currentVersion == "" {
+		err = importLegacyFiles(config)
+		if err != nil {
+			return err
+		}
+		currentVersion, err = linkedVersion(current)
+		if err != nil {
+			return err
+		}
+	}
+	version, err := createVersion(config.OutputDirectory, func(dir string) error {
+		versionConfig := *config
+		versionConfig.OutputDirectory = dir
+		return saveResource(resource, &versionConfig)
+	})
+	if err != nil {
+		return err
+	}
+	// Keep the oldest uncommitted version as previous version
+	previousVersion, err := linkedVersion(previous)
+	if err != nil {
+		return err
+	}
+	if previousVersion == "" && currentVersion != "" {
+		err = swapLink(filepath.Join(VERSIONS_DIRECTORY, currentVersion), previous)
+		if err != nil {
+			return err
+		}
+	}
+	err = swapLink(filepath.Join(VERSIONS_DIRECTORY, version), current)
+	if err != nil {
+		return err
+	}
+	// Point certificate files to current version
+	for _, name := range resourceFiles(config) {
+		err = swapLink(filepath.Join(CURRENT_LINK, name), filepath.Join(config.OutputDirectory, name))
+		if err != nil {
+			return err
+		}
+	}
+	log.Infof("[%s] Installed certificate version %s", config.Domains[0], version)
+	return nil
+}
+
+// Forget previous version once new certificates are in use, and remove versions exceeding retention
+func CommitCertificate(config *configuration.UserConfig) error {
+	err := os.Remove(filepath.Join(config.OutputDirectory, PREVIOUS_LINK))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return pruneVersions(config)
+}
+
+// Restore previous version of certificates.
+//
+// Return the name of restored version, or an empty string when there is no previous version.
+func RestoreCertificate(config *configuration.UserConfig) (string, error) {
+	previous := filepath.Join(config.OutputDirectory, PREVIOUS_LINK)
+	version, err := linkedVersion(previous)
+	if err != nil || version == "" {
+		return "", err
+	}
+	err = swapLink(filepath.Join(VERSIONS_DIRECTORY, version), filepath.Join(config.OutputDirectory, CURRENT_LINK))
+	if err != nil {
+		return "", err
+	}
+	return version, os.Remove(previous)
+}
+
+// List versions found in output directory, from oldest to newest
+func listVersions(outputDirectory string) ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(outputDirectory, VERSIONS_DIRECTORY))
+	if errors.Is(err, os.ErrNotExist) {
+		return []string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	versions := []string{}
+	for _, entry := range entries {
+		if entry.IsDir() && !strings.HasPrefix(entry.Name(), ".") {
+			versions = append(versions, entry.Name())
+		}
+	}
+	sort.Strings(versions)
+	return versions, nil
+}
+
+// Remove oldest versions, keeping OUTPUT_RETENTION versions as well as current and previous versions
+func pruneVersions(config *configuration.UserConfig) error {
+	versions, err := listVersions(config.OutputDirectory)
+	if err != nil {
+		return err
+	}
+	current, err := linkedVersion(filepath.Join(config.OutputDirectory, CURRENT_LINK))
+	if err != nil {
+		return err
+	}
+	previous, err := linkedVersion(filepath.Join(config.OutputDirectory, PREVIOUS_LINK))
+	if err != nil {
+		return err
+	}
+	for i := 0; i < len(versions)-config.OutputRetention; i++ {
+		if versions[i] == current || versions[i] == previous {
+			continue
+		}
+		err = os.RemoveAll(filepath.Join(config.OutputDirectory, VERSIONS_DIRECTORY, versions[i]))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// A certificate stored in a version
+type VersionCertificate struct {
+	Filename     string
+	Domains      []string
+	Issuer       string
+	SerialNumber string
+	NotBefore    time.Time
+	NotAfter     time.Time
+}
+
+// A version of certificates stored in output directory
+type CertificateVersion struct {
+	Version      string
+	IssuedAt     time.Time
+	Current      bool
+	Certificates []VersionCertificate
+}
+
+// List versions of certificates stored in output directory, from oldest to newest
+func CertificateHistory(config *configuration.UserConfig) ([]CertificateVersion, error) {
+	versions, err := listVersions(config.OutputDirectory)
+	if err != nil {
+		return nil, err
+	}
+	current, err := linkedVersion(filepath.Join(config.OutputDirectory, CURRENT_LINK))
+	if err != nil {
+		return nil, err
+	}
+	history := []CertificateVersion{}
+	for _, version := range versions {
+		dir := filepath.Join(config.OutputDirectory, VERSIONS_DIRECTORY, version)
+		issuedAt, _ := time.Parse(VERSION_LAYOUT, version)
+		entry := CertificateVersion{
+			Version:      version,
+			IssuedAt:     issuedAt,
+			Current:      version == current,
+			Certificates: []VersionCertificate{},
+		}
+		files, err := filepath.Glob(filepath.Join(dir, "*.crt"))
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range files {
+			if strings.HasSuffix(file, ".issuer.crt") {
+				continue
+			}
+			certs, err := readCert(file)
+			if err != nil {
+				return nil, err
+			}
+			entry.Certificates = append(entry.Certificates, describeCertificate(strings.TrimSuffix(filepath.Base(file), ".crt"), certs[0]))
+		}
+		history = append(history, entry)
+	}
+	return history, nil
+}
+
+// Describe a certificate stored under filename
+func describeCertificate(filename string, cert *x509.Certificate) VersionCertificate {
+	return VersionCertificate{
+		Filename:     filename,
+		Domains:      certcrypto.ExtractDomains(cert),
+		Issuer:       cert.Issuer.CommonName,
+		SerialNumber: cert.SerialNumber.Text(16),
+		NotBefore:    cert.NotBefore,
+		NotAfter:     cert.NotAfter,
+	}
+}
+
+// Describe certificates currently in use, one per key type
+func CurrentCertificates(config *configuration.UserConfig) ([]VersionCertificate, error) {
+	certs := []VersionCertificate{}
+	for _, certConfig := range CertificateConfigs(config) {
+		cert, err := ReadCertificate(certConfig)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, describeCertificate(certConfig.Filename, cert))
+	}
+	return certs, nil
+}
@@ -0,0 +1,307 @@
+package acme
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-acme/lego/v4/certcrypto"
+	"github.com/go-acme/lego/v4/certificate"
+
+	"github.com/quara-dev/letsgo-nats/configuration"
+)
+
+// Generate a certificate resource signed by a test CA
+func newTestResource(t *testing.T, domains ...string) *certificate.Resource {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(365 * 24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	caDer, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	caCert, err := x509.ParseCertificate(caDer)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: domains[0]},
+		DNSNames:     domains,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(90 * 24 * time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, caCert, &key.PublicKey, caKey)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	issuer := certcrypto.PEMEncode(certcrypto.DERCertificateBytes(caDer))
+	return &certificate.Resource{
+		Domain:            domains[0],
+		Certificate:       append(certcrypto.PEMEncode(certcrypto.DERCertificateBytes(der)), issuer...),
+		PrivateKey:        certcrypto.PEMEncode(key),
+		IssuerCertificate: issuer,
+	}
+}
+
+// Test that a valid certificate resource is accepted
+func TestValidateResource(t *testing.T) {
+	config := &configuration.UserConfig{Domains: []string{"example.com", "www.example.com"}}
+	err := ValidateResource(newTestResource(t, "example.com", "www.example.com"), config)
+	if err != nil {
+		t.Errorf(err.Error())
+	}
+}
+
+// Test that a private key which does not match certificate is rejected
+func TestValidateResourceKeyMismatch(t *testing.T) {
+	config := &configuration.UserConfig{Domains: []string{"example.com"}}
+	resource := newTestResource(t, "example.com")
+	resource.PrivateKey = newTestResource(t, "example.com").PrivateKey
+	err := ValidateResource(resource, config)
+	if err == nil {
+		t.Errorf("Key mismatch was not detected")
+	}
+}
+
+// Test that a certificate which does not chain to issuer certificate is rejected
+func TestValidateResourceChainMismatch(t *testing.T) {
+	config := &configuration.UserConfig{Domains: []string{"example.com"}}
+	resource := newTestResource(t, "example.com")
+	other := newTestResource(t, "example.com")
+	bundle, err := certcrypto.ParsePEMBundle(resource.Certificate)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	resource.Certificate = certcrypto.PEMEncode(certcrypto.DERCertificateBytes(bundle[0].Raw))
+	resource.IssuerCertificate = other.IssuerCertificate
+	err = ValidateResource(resource, config)
+	if err == nil {
+		t.Errorf("Chain mismatch was not detected")
+	}
+}
+
+// Test that installed certificates are validated like certificates before install
+func TestValidateInstalledCertificates(t *testing.T) {
+	config := &configuration.UserConfig{
+		OutputDirectory: t.TempDir(),
+		Filename:        "example.com",
+		Domains:         []string{"example.com"},
+	}
+	if err := ValidateInstalledCertificates(config); err == nil {
+		t.Errorf("Missing certificates were not detected")
+	}
+	resource := newTestResource(t, "example.com")
+	if err := saveResource(resource, config); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if err := ValidateInstalledCertificates(config); err != nil {
+		t.Errorf(err.Error())
+	}
+	resource.PrivateKey = newTestResource(t, "example.com").PrivateKey
+	if err := saveResource(resource, config); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if err := ValidateInstalledCertificates(config); err == nil {
+		t.Errorf("Key mismatch was not detected")
+	}
+}
+
+// Test that certificates are installed as a new version pointed by current symlink
+func TestInstallResource(t *testing.T) {
+	config := &configuration.UserConfig{
+		OutputDirectory: t.TempDir(),
+		OutputRetention: 5,
+		Filename:        "example.com",
+		Domains:         []string{"example.com"},
+	}
+	resource := newTestResource(t, "example.com")
+	err := installResource(resource, config)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	target, err := os.Readlink(filepath.Join(config.OutputDirectory, "example.com.crt"))
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if target != filepath.Join(CURRENT_LINK, "example.com.crt") {
+		t.Errorf("Bad symlink target. Want: %s. Got: %s", filepath.Join(CURRENT_LINK, "example.com.crt"), target)
+	}
+	loaded, err := loadResource(config)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if string(loaded.Certificate) != string(resource.Certificate) {
+		t.Errorf("Installed certificate was not loaded")
+	}
+	history, err := CertificateHistory(config)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if len(history) != 1 || !history[0].Current || len(history[0].Certificates) != 1 {
+		t.Fatalf("Bad history: %+v", history)
+	}
+	if history[0].Certificates[0].Filename != "example.com" || history[0].Certificates[0].Domains[0] != "example.com" {
+		t.Errorf("Bad history certificate: %+v", history[0].Certificates[0])
+	}
+}
+
+// Test that certificate files written by previous releases are kept as previous version
+func TestInstallResourceImportsLegacyFiles(t *testing.T) {
+	config := &configuration.UserConfig{
+		OutputDirectory: t.TempDir(),
+		OutputRetention: 5,
+		Filename:        "example.com",
+		Domains:         []string{"example.com"},
+	}
+	legacy := newTestResource(t, "example.com")
+	err := saveResource(legacy, config)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	err = installResource(newTestResource(t, "example.com"), config)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	restored, err := RestoreCertificate(config)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if restored == "" {
+		t.Fatalf("Legacy certificate was not restored")
+	}
+	content, err := os.ReadFile(filepath.Join(config.OutputDirectory, "example.com.crt"))
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if string(content) != string(legacy.Certificate) {
+		t.Errorf("Legacy certificate was not restored")
+	}
+}
+
+// Test that previous version is restored until new version is committed
+func TestInstallAndRestoreResource(t *testing.T) {
+	config := &configuration.UserConfig{
+		OutputDirectory: t.TempDir(),
+		OutputRetention: 5,
+		Filename:        "example.com",
+		Domains:         []string{"example.com"},
+	}
+	previous := newTestResource(t, "example.com")
+	err := installResource(previous, config)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	err = CommitCertificate(config)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	err = installResource(newTestResource(t, "example.com"), config)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	restored, err := RestoreCertificate(config)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if restored == "" {
+		t.Fatalf("Previous version was not restored")
+	}
+	content, err := os.ReadFile(filepath.Join(config.OutputDirectory, "example.com.crt"))
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if string(content) != string(previous.Certificate) {
+		t.Errorf("Previous certificate was not restored")
+	}
+	// Nothing is left to restore once certificates are committed
+	err = installResource(newTestResource(t, "example.com"), config)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	err = CommitCertificate(config)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	restored, _ = RestoreCertificate(config)
+	if restored != "" {
+		t.Errorf("Bad restored version. Want: \"\". Got: %s", restored)
+	}
+}
+
+// Test that oldest versions are removed according to retention
+func TestPruneVersions(t *testing.T) {
+	config := &configuration.UserConfig{
+		OutputDirectory: t.TempDir(),
+		OutputRetention: 2,
+		Filename:        "example.com",
+		Domains:         []string{"example.com"},
+	}
+	for i := 0; i < 4; i++ {
+		err := installResource(newTestResource(t, "example.com"), config)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		err = CommitCertificate(config)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+	}
+	history, err := CertificateHistory(config)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if len(history) != 2 {
+		t.Fatalf("Bad number of versions. Want: 2. Got: %d", len(history))
+	}
+	if !history[1].Current {
+		t.Errorf("Newest version is not current version")
+	}
+}
+
+// Test that certificates which were not replaced are never revoked
+func TestRevokeReplacedCertificatesInUse(t *testing.T) {
+	config := &configuration.UserConfig{
+		OutputDirectory: t.TempDir(),
+		OutputRetention: 5,
+		Filename:        "example.com",
+		Domains:         []string{"example.com"},
+	}
+	err := installResource(newTestResource(t, "example.com"), config)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	previous := LoadCertificatesPEM(config)
+	if len(previous) != 1 {
+		t.Fatalf("Bad number of certificates. Want: 1. Got: %d", len(previous))
+	}
+	revoked, err := RevokeReplacedCertificates(config, previous, 0)
+	err_want := "example.com: certificate was not replaced, so it was not revoked"
+	if err == nil || err.Error() != err_want {
+		t.Errorf("Bad error. Want: %s. Got: %v", err_want, err)
+	}
+	if revoked != 0 {
+		t.Errorf("Bad number of revoked certificates. Want: 0. Got: %d", revoked)
+	}
+}
@@ -0,0 +1,82 @@
+package acme
+
+import (
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/go-acme/lego/v4/challenge/dns01"
+
+	"github.com/quara-dev/letsgo-nats/metrics"
+)
+
+// Buckets used for durations of ACME operations and DNS propagation, in seconds
+var DURATION_BUCKETS = []float64{1, 2, 5, 10, 30, 60, 120, 300, 600}
+
+var renewalAttempts = metrics.NewCounter(
+	"letsgo_renewal_attempts_total",
+	"Number of certificate requests, including renewals.",
+	"filename",
+)
+
+var renewalFailures = metrics.NewCounter(
+	"letsgo_renewal_failures_total",
+	"Number of failed certificate requests, by reason. Reason is the ACME error type when returned by CA.",
+	"filename", "reason",
+)
+
+var acmeDuration = metrics.NewHistogram(
+	"letsgo_acme_operation_duration_seconds",
+	"Duration of ACME operations, including challenge resolution.",
+	DURATION_BUCKETS,
+	"operation", "result",
+)
+
+var dnsPropagationWait = metrics.NewHistogram(
+	"letsgo_dns_propagation_wait_seconds",
+	"Time spent waiting for DNS-01 challenge records to propagate.",
+	DURATION_BUCKETS,
+)
+
+// ACME error types, as found in error messages
+var acmeErrorPattern = regexp.MustCompile(`urn:ietf:params:acme:error:(\w+)`)
+
+// Get the reason of a failed certificate request
+func requestFailureReason(err error) string {
+	if match := acmeErrorPattern.FindStringSubmatch(err.Error()); match != nil {
+		return match[1]
+	}
+	return "request"
+}
+
+// Record the duration of an ACME operation started at start
+func observeOperation(operation string, start time.Time, err error) {
+	result := "success"
+	if err != nil {
+		result = "failure"
+	}
+	acmeDuration.Observe(time.Since(start).Seconds(), operation, result)
+}
+
+// Wrap DNS propagation checks to measure time spent waiting for challenge records
+func measurePropagation() dns01.WrapPreCheckFunc {
+	var mu sync.Mutex
+	started := map[string]time.Time{}
+	return func(domain, fqdn, value string, check dns01.PreCheckFunc) (bool, error) {
+		mu.Lock()
+		start, ok := started[fqdn]
+		if !ok {
+			start = time.Now()
+			started[fqdn] = start
+		}
+		mu.Unlock()
+		propagated, err := check(fqdn, value)
+		if propagated || err != nil {
+			dnsPropagationWait.Observe(time.Since(start).Seconds())
+			mu.Lock()
+			delete(started, fqdn)
+			mu.Unlock()
+		}
+		return propagated, err
+	}
+}
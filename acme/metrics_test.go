@@ -0,0 +1,33 @@
+package acme
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestRequestFailureReason(t *testing.T) {
+	err := errors.New("acme: error: 429 :: POST :: https://acme-staging-v02.api.letsencrypt.org/acme/new-order :: urn:ietf:params:acme:error:rateLimited :: Error creating new order")
+	if reason := requestFailureReason(err); reason != "rateLimited" {
+		t.Errorf("Bad failure reason. Want: rateLimited. Got: %s", reason)
+	}
+	err = errors.New("dial tcp: lookup acme-v02.api.letsencrypt.org: no such host")
+	if reason := requestFailureReason(err); reason != "request" {
+		t.Errorf("Bad failure reason. Want: request. Got: %s", reason)
+	}
+}
+
+func TestMeasurePropagation(t *testing.T) {
+	wrap := measurePropagation()
+	checks := 0
+	check := func(fqdn, value string) (bool, error) {
+		checks += 1
+		return checks == 3, nil
+	}
+	count := dnsPropagationWait.Count()
+	for i := 0; i < 3; i++ {
+		wrap("example.com", "_acme-challenge.example.com.", "value", check)
+	}
+	if dnsPropagationWait.Count() != count+1 {
+		t.Errorf("Bad number of propagation waits. Want: %d. Got: %d", count+1, dnsPropagationWait.Count())
+	}
+}
@@ -0,0 +1,109 @@
+package acme
+
+import (
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/go-acme/lego/v4/certcrypto"
+	"golang.org/x/exp/slices"
+
+	"github.com/quara-dev/letsgo-nats/configuration"
+	"github.com/quara-dev/letsgo-nats/constants"
+)
+
+// Organization of issuers of certificates delivered by known CA directories
+var expectedIssuers = map[string]string{
+	constants.ACME_PRODUCTION_CA_DIR: "Let's Encrypt",
+	constants.ACME_STAGING_CA_DIR:    "(STAGING) Let's Encrypt",
+	constants.ACME_ZEROSSL_CA_DIR:    "ZeroSSL",
+	constants.ACME_GOOGLE_CA_DIR:     "Google Trust Services",
+}
+
+// Get key type of a certificate public key
+func getPublicKeyType(cert *x509.Certificate) (certcrypto.KeyType, error) {
+	switch key := cert.PublicKey.(type) {
+	case *rsa.PublicKey:
+		switch key.N.BitLen() {
+		case 2048:
+			return certcrypto.RSA2048, nil
+		case 4096:
+			return certcrypto.RSA4096, nil
+		case 8192:
+			return certcrypto.RSA8192, nil
+		}
+		return "", errors.New(fmt.Sprintf("unsupported RSA key size %d", key.N.BitLen()))
+	case *ecdsa.PublicKey:
+		switch key.Curve.Params().Name {
+		case "P-256":
+			return certcrypto.EC256, nil
+		case "P-384":
+			return certcrypto.EC384, nil
+		}
+		return "", errors.New(fmt.Sprintf("unsupported ECDSA curve %s", key.Curve.Params().Name))
+	}
+	return "", errors.New(fmt.Sprintf("unsupported public key algorithm %s", cert.PublicKeyAlgorithm))
+}
+
+// Check whether certificate issuer organization starts with expected organization
+func hasIssuer(cert *x509.Certificate, issuer string) bool {
+	for _, organization := range cert.Issuer.Organization {
+		if strings.HasPrefix(organization, issuer) {
+			return true
+		}
+	}
+	return false
+}
+
+// Normalize a list of domains for comparison
+func normalizeDomains(domains []string) []string {
+	normalized := []string{}
+	for _, domain := range domains {
+		domain = strings.ToLower(strings.TrimSpace(domain))
+		if !slices.Contains(normalized, domain) {
+			normalized = append(normalized, domain)
+		}
+	}
+	sort.Strings(normalized)
+	return normalized
+}
+
+// Get the name of the key type of a certificate, e.g. EC256
+func KeyTypeName(cert *x509.Certificate) string {
+	keyType, err := getPublicKeyType(cert)
+	if err != nil {
+		return cert.PublicKeyAlgorithm.String()
+	}
+	return keyTypeNames[keyType]
+}
+
+// Check that a certificate matches user configuration.
+//
+// Return an error describing the mismatch when the certificate was issued for
+// other domains, with another key type, or by another CA than configured.
+func CheckCertificateMatch(cert *x509.Certificate, config *configuration.UserConfig) error {
+	// Check SANs
+	got := normalizeDomains(certcrypto.ExtractDomains(cert))
+	want := normalizeDomains(config.Domains)
+	if !slices.Equal(got, want) {
+		return errors.New(fmt.Sprintf("certificate domains [%s] do not match configured domains [%s]", strings.Join(got, ", "), strings.Join(want, ", ")))
+	}
+	// Check key algorithm and size
+	keyType, err := getPublicKeyType(cert)
+	if err != nil {
+		return err
+	}
+	if keyType != config.CADirKeyType {
+		return errors.New(fmt.Sprintf("certificate key type %s does not match configured key type %s", keyTypeNames[keyType], keyTypeNames[config.CADirKeyType]))
+	}
+	// Check issuer when CA directory is known
+	issuer, ok := expectedIssuers[config.CADirURL]
+	if ok && !hasIssuer(cert, issuer) {
+		return errors.New(fmt.Sprintf("certificate issuer %q does not match expected issuer %q for CA directory %s", strings.Join(cert.Issuer.Organization, ", "), issuer, config.CADirURL))
+	}
+	return nil
+}
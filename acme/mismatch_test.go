@@ -0,0 +1,69 @@
+package acme
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-acme/lego/v4/certcrypto"
+
+	"github.com/quara-dev/letsgo-nats/configuration"
+	"github.com/quara-dev/letsgo-nats/constants"
+)
+
+// Test that a certificate matching configuration is kept
+func TestCertificateMatch(t *testing.T) {
+	cert := newTestCertificate(t, time.Now(), time.Now().Add(90*24*time.Hour), "example.com", "www.example.com")
+	config := &configuration.UserConfig{
+		Domains:      []string{"WWW.example.com", "example.com"},
+		CADirKeyType: certcrypto.EC256,
+		CADirURL:     "https://ca.example.com/directory",
+	}
+	err := CheckCertificateMatch(cert, config)
+	if err != nil {
+		t.Errorf(err.Error())
+	}
+}
+
+// Test that a mismatch is detected when domains change
+func TestCertificateDomainsMismatch(t *testing.T) {
+	cert := newTestCertificate(t, time.Now(), time.Now().Add(90*24*time.Hour), "example.com")
+	config := &configuration.UserConfig{
+		Domains:      []string{"example.com", "www.example.com"},
+		CADirKeyType: certcrypto.EC256,
+		CADirURL:     "https://ca.example.com/directory",
+	}
+	err := CheckCertificateMatch(cert, config)
+	err_want := "certificate domains [example.com] do not match configured domains [example.com, www.example.com]"
+	if err == nil || err.Error() != err_want {
+		t.Errorf("Bad error. Want: %s. Got: %v", err_want, err)
+	}
+}
+
+// Test that a mismatch is detected when key type changes
+func TestCertificateKeyTypeMismatch(t *testing.T) {
+	cert := newTestCertificate(t, time.Now(), time.Now().Add(90*24*time.Hour), "example.com")
+	config := &configuration.UserConfig{
+		Domains:      []string{"example.com"},
+		CADirKeyType: certcrypto.RSA2048,
+		CADirURL:     "https://ca.example.com/directory",
+	}
+	err := CheckCertificateMatch(cert, config)
+	err_want := "certificate key type EC256 does not match configured key type RSA2048"
+	if err == nil || err.Error() != err_want {
+		t.Errorf("Bad error. Want: %s. Got: %v", err_want, err)
+	}
+}
+
+// Test that a mismatch is detected when certificate was not issued by configured CA
+func TestCertificateIssuerMismatch(t *testing.T) {
+	cert := newTestCertificate(t, time.Now(), time.Now().Add(90*24*time.Hour), "example.com")
+	config := &configuration.UserConfig{
+		Domains:      []string{"example.com"},
+		CADirKeyType: certcrypto.EC256,
+		CADirURL:     constants.ACME_PRODUCTION_CA_DIR,
+	}
+	err := CheckCertificateMatch(cert, config)
+	if err == nil {
+		t.Errorf("Issuer mismatch was not detected")
+	}
+}
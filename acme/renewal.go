@@ -0,0 +1,214 @@
+package acme
+
+import (
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-acme/lego/v4/log"
+
+	"github.com/quara-dev/letsgo-nats/configuration"
+)
+
+// Sources of renewal windows
+const RENEWAL_WINDOW_ARI = "ari"
+const RENEWAL_WINDOW_LIFETIME = "lifetime"
+
+// Timeout of requests sent to fetch renewal information
+const ARI_REQUEST_TIMEOUT = 10 * time.Second
+
+// Window during which a certificate should be renewed
+type RenewalWindow struct {
+	Start          time.Time
+	End            time.Time
+	ExplanationURL string
+	Source         string
+}
+
+// Pick a random time inside the renewal window
+func (w RenewalWindow) RandomTime() time.Time {
+	span := w.End.Sub(w.Start)
+	if span <= 0 {
+		return w.Start
+	}
+	return w.Start.Add(time.Duration(rand.Int63n(int64(span))))
+}
+
+// Renewal window suggested by the CA (ACME Renewal Information)
+type renewalInfo struct {
+	SuggestedWindow struct {
+		Start time.Time `json:"start"`
+		End   time.Time `json:"end"`
+	} `json:"suggestedWindow"`
+	ExplanationURL string `json:"explanationURL"`
+}
+
+// Subset of ACME directory used to discover ARI endpoint
+type directory struct {
+	RenewalInfo string `json:"renewalInfo"`
+}
+
+// Get the renewal window of a certificate.
+//
+// The window suggested by the CA through ACME Renewal Information (ARI) is used when
+// the CA supports it. Otherwise, the certificate is renewed once the remaining part
+// of its lifetime drops below the percentage configured by user.
+func GetRenewalWindow(config *configuration.UserConfig, cert *x509.Certificate) RenewalWindow {
+	window, err := fetchRenewalWindow(config.CADirURL, cert)
+	ariErrorsMu.Lock()
+	defer ariErrorsMu.Unlock()
+	if err == nil {
+		delete(ariErrors, config.Filename)
+		return window
+	}
+	// Log each new error, so that operators know why the window suggested by CA is ignored
+	if previous, ok := ariErrors[config.Filename]; !ok || previous != err.Error() {
+		log.Warnf("[%s] Failed to fetch renewal information, using certificate lifetime instead: %v", cert.Subject.CommonName, err)
+	}
+	ariErrors[config.Filename] = err.Error()
+	return lifetimeRenewalWindow(cert, config.RenewRemainingPercent)
+}
+
+// Last error met while fetching renewal information, by certificate filename
+var ariErrors = map[string]string{}
+var ariErrorsMu sync.Mutex
+
+// Renewal time picked for a certificate
+type renewalSchedule struct {
+	Serial  string    `json:"serial"`
+	RenewAt time.Time `json:"renew_at"`
+}
+
+// Get path to the file holding the renewal time of a certificate, next to certificate versions
+func renewalScheduleFile(config *configuration.UserConfig) string {
+	return filepath.Join(config.OutputDirectory, VERSIONS_DIRECTORY, config.Filename+".renewal.json")
+}
+
+// Get the time at which a certificate must be renewed.
+//
+// A random time is picked inside the renewal window once per certificate, and
+// saved so that daily checks do not pick new times, which would skew renewals
+// toward the start of the window. A new time is picked when the saved time falls
+// outside of the window, e.g. when the CA requests an early renewal.
+func renewalTime(config *configuration.UserConfig, cert *x509.Certificate, window RenewalWindow) time.Time {
+	serial := cert.SerialNumber.Text(16)
+	saved := renewalSchedule{}
+	if content, err := os.ReadFile(renewalScheduleFile(config)); err == nil && json.Unmarshal(content, &saved) == nil {
+		if saved.Serial == serial && !saved.RenewAt.Before(window.Start) && !saved.RenewAt.After(window.End) {
+			return saved.RenewAt
+		}
+	}
+	schedule := renewalSchedule{Serial: serial, RenewAt: window.RandomTime()}
+	err := saveRenewalSchedule(config, schedule)
+	if err != nil {
+		log.Warnf("[%s] Failed to save certificate renewal time: %v", cert.Subject.CommonName, err)
+	}
+	return schedule.RenewAt
+}
+
+// Save renewal time of a certificate
+func saveRenewalSchedule(config *configuration.UserConfig, schedule renewalSchedule) error {
+	err := os.MkdirAll(filepath.Join(config.OutputDirectory, VERSIONS_DIRECTORY), 0o700)
+	if err != nil {
+		return err
+	}
+	content, err := json.MarshalIndent(schedule, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(renewalScheduleFile(config), content, 0o600)
+}
+
+// Renewal window computed from certificate lifetime.
+//
+// The window starts when less than given percentage of lifetime remains,
+// and ends halfway between window start and certificate expiration.
+func lifetimeRenewalWindow(cert *x509.Certificate, percent float64) RenewalWindow {
+	lifetime := cert.NotAfter.Sub(cert.NotBefore)
+	remaining := time.Duration(float64(lifetime) * percent / 100)
+	start := cert.NotAfter.Add(-remaining)
+	return RenewalWindow{
+		Start:  start,
+		End:    start.Add(remaining / 2),
+		Source: RENEWAL_WINDOW_LIFETIME,
+	}
+}
+
+// Fetch renewal window suggested by the CA
+func fetchRenewalWindow(caDirURL string, cert *x509.Certificate) (RenewalWindow, error) {
+	client := &http.Client{Timeout: ARI_REQUEST_TIMEOUT}
+	endpoint, err := getRenewalInfoEndpoint(client, caDirURL)
+	if err != nil {
+		return RenewalWindow{}, err
+	}
+	certID, err := getARICertID(cert)
+	if err != nil {
+		return RenewalWindow{}, err
+	}
+	resp, err := client.Get(strings.TrimSuffix(endpoint, "/") + "/" + certID)
+	if err != nil {
+		return RenewalWindow{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return RenewalWindow{}, errors.New(fmt.Sprintf("Unexpected status code while fetching renewal information: %d", resp.StatusCode))
+	}
+	info := renewalInfo{}
+	err = json.NewDecoder(resp.Body).Decode(&info)
+	if err != nil {
+		return RenewalWindow{}, err
+	}
+	if info.SuggestedWindow.Start.IsZero() || info.SuggestedWindow.End.Before(info.SuggestedWindow.Start) {
+		return RenewalWindow{}, errors.New("Invalid renewal window suggested by CA")
+	}
+	return RenewalWindow{
+		Start:          info.SuggestedWindow.Start,
+		End:            info.SuggestedWindow.End,
+		ExplanationURL: info.ExplanationURL,
+		Source:         RENEWAL_WINDOW_ARI,
+	}, nil
+}
+
+// Discover ARI endpoint from ACME directory
+func getRenewalInfoEndpoint(client *http.Client, caDirURL string) (string, error) {
+	resp, err := client.Get(caDirURL)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	dir := directory{}
+	err = json.NewDecoder(resp.Body).Decode(&dir)
+	if err != nil {
+		return "", err
+	}
+	if dir.RenewalInfo == "" {
+		return "", errors.New("CA does not support ACME Renewal Information")
+	}
+	return dir.RenewalInfo, nil
+}
+
+// Get unique identifier of a certificate as expected by ARI.
+//
+// Identifier is made of the base64url-encoded authority key identifier and
+// serial number of the certificate, separated by a dot.
+func getARICertID(cert *x509.Certificate) (string, error) {
+	if len(cert.AuthorityKeyId) == 0 {
+		return "", errors.New("Certificate does not have an authority key identifier")
+	}
+	serial := cert.SerialNumber.Bytes()
+	// Serial number is encoded as a positive DER integer
+	if len(serial) > 0 && serial[0]&0x80 != 0 {
+		serial = append([]byte{0}, serial...)
+	}
+	aki := base64.RawURLEncoding.EncodeToString(cert.AuthorityKeyId)
+	return aki + "." + base64.RawURLEncoding.EncodeToString(serial), nil
+}
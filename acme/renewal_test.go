@@ -0,0 +1,126 @@
+package acme
+
+import (
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/quara-dev/letsgo-nats/configuration"
+)
+
+// Test that ARI certificate identifier is computed from AKI and serial number
+func TestGetARICertID(t *testing.T) {
+	cert := newTestCertificate(t, time.Now(), time.Now().Add(90*24*time.Hour), "example.com")
+	got, err := getARICertID(cert)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	want := "aYhba4dGQEHhs3uEe6CuLN4ByNQ.AIdlQyE"
+	if got != want {
+		t.Errorf("got %q, wanted %q", got, want)
+	}
+}
+
+// Test that renewal window falls back to certificate lifetime when CA does not support ARI
+func TestGetRenewalWindowFallback(t *testing.T) {
+	ca := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"newOrder": "http://localhost/new-order"}`))
+	}))
+	defer ca.Close()
+
+	notBefore := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	cert := newTestCertificate(t, notBefore, notBefore.Add(100*24*time.Hour), "example.com")
+	config := &configuration.UserConfig{CADirURL: ca.URL, RenewRemainingPercent: 30}
+	window := GetRenewalWindow(config, cert)
+	if window.Source != RENEWAL_WINDOW_LIFETIME {
+		t.Fatalf("Bad window source. Want: %s. Got: %s", RENEWAL_WINDOW_LIFETIME, window.Source)
+	}
+	if !window.Start.Equal(notBefore.Add(70 * 24 * time.Hour)) {
+		t.Errorf("Bad window start: %s", window.Start)
+	}
+	if !window.End.Equal(notBefore.Add(85 * 24 * time.Hour)) {
+		t.Errorf("Bad window end: %s", window.End)
+	}
+}
+
+// Test that renewal window suggested by CA is used when available
+func TestGetRenewalWindowFromARI(t *testing.T) {
+	start := time.Date(2023, 2, 1, 0, 0, 0, 0, time.UTC)
+	end := start.Add(48 * time.Hour)
+	var ca *httptest.Server
+	ca = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/directory":
+			json.NewEncoder(w).Encode(map[string]string{"renewalInfo": ca.URL + "/renewal-info/"})
+		case "/renewal-info/aYhba4dGQEHhs3uEe6CuLN4ByNQ.AIdlQyE":
+			info := renewalInfo{ExplanationURL: "https://example.com/incident"}
+			info.SuggestedWindow.Start = start
+			info.SuggestedWindow.End = end
+			json.NewEncoder(w).Encode(info)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ca.Close()
+
+	cert := newTestCertificate(t, time.Now(), time.Now().Add(90*24*time.Hour), "example.com")
+	config := &configuration.UserConfig{CADirURL: ca.URL + "/directory", RenewRemainingPercent: 30, OutputDirectory: t.TempDir(), Filename: "example.com"}
+	window := GetRenewalWindow(config, cert)
+	if window.Source != RENEWAL_WINDOW_ARI {
+		t.Fatalf("Bad window source. Want: %s. Got: %s", RENEWAL_WINDOW_ARI, window.Source)
+	}
+	if !window.Start.Equal(start) || !window.End.Equal(end) {
+		t.Errorf("Bad window: %s - %s", window.Start, window.End)
+	}
+	renewAt := window.RandomTime()
+	if renewAt.Before(start) || renewAt.After(end) {
+		t.Errorf("Random time is outside of renewal window: %s", renewAt)
+	}
+	// Window is in the past, so certificate must be renewed
+	renew, err := needRenewal(cert, config)
+	if err != nil || !renew {
+		t.Errorf("Certificate should be renewed when renewal window is reached")
+	}
+}
+
+// Test that renewal time is picked once per certificate
+func TestRenewalTime(t *testing.T) {
+	notBefore := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	cert := newTestCertificate(t, notBefore, notBefore.Add(100*24*time.Hour), "example.com")
+	config := &configuration.UserConfig{OutputDirectory: t.TempDir(), Filename: "example.com"}
+	window := lifetimeRenewalWindow(cert, 30)
+	want := renewalTime(config, cert, window)
+	if want.Before(window.Start) || want.After(window.End) {
+		t.Fatalf("Renewal time is outside of renewal window: %s", want)
+	}
+	for i := 0; i < 10; i++ {
+		if got := renewalTime(config, cert, window); !got.Equal(want) {
+			t.Fatalf("Bad renewal time. Want: %s. Got: %s", want, got)
+		}
+	}
+	// A new time is picked when window moves
+	early := RenewalWindow{Start: notBefore, End: notBefore.Add(time.Hour)}
+	got := renewalTime(config, cert, early)
+	if got.Before(early.Start) || got.After(early.End) {
+		t.Errorf("Renewal time is outside of moved renewal window: %s", got)
+	}
+	// Renewal time is saved with the serial number of certificate
+	other := *cert
+	other.SerialNumber = big.NewInt(1)
+	renewalTime(config, &other, window)
+	content, err := os.ReadFile(renewalScheduleFile(config))
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	saved := renewalSchedule{}
+	if err := json.Unmarshal(content, &saved); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if saved.Serial != "1" {
+		t.Errorf("Bad saved serial number. Want: 1. Got: %s", saved.Serial)
+	}
+}
@@ -0,0 +1,56 @@
+package acme
+
+import (
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/quara-dev/letsgo-nats/configuration"
+)
+
+// Policy used to retry failed certificate renewals
+type RetryPolicy struct {
+	InitialInterval time.Duration
+	MaxInterval     time.Duration
+	Multiplier      float64
+	Jitter          float64
+}
+
+// Create retry policy according to user configuration
+func NewRetryPolicy(config *configuration.UserConfig) RetryPolicy {
+	return RetryPolicy{
+		InitialInterval: config.RetryInitialInterval,
+		MaxInterval:     config.RetryMaxInterval,
+		Multiplier:      config.RetryMultiplier,
+		Jitter:          config.RetryJitter,
+	}
+}
+
+// Get delay before next attempt after a number of consecutive failures.
+//
+// Delay grows exponentially from InitialInterval up to MaxInterval.
+// When certificate expiration date is known (non-zero notAfter), delay
+// is also limited to a tenth of the remaining validity, so that retries
+// become more aggressive as expiration date gets closer.
+// A random jitter is applied to avoid retrying at the same time across servers.
+func (p RetryPolicy) NextDelay(failures int, notAfter time.Time) time.Duration {
+	if failures < 1 {
+		failures = 1
+	}
+	delay := float64(p.InitialInterval) * math.Pow(p.Multiplier, float64(failures-1))
+	max := float64(p.MaxInterval)
+	if !notAfter.IsZero() {
+		remaining := float64(time.Until(notAfter)) / 10
+		if remaining < max {
+			max = remaining
+		}
+	}
+	if max < float64(p.InitialInterval) {
+		max = float64(p.InitialInterval)
+	}
+	if delay > max {
+		delay = max
+	}
+	delay = delay * (1 + p.Jitter*(2*rand.Float64()-1))
+	return time.Duration(delay)
+}
@@ -0,0 +1,59 @@
+package acme
+
+import (
+	"testing"
+	"time"
+)
+
+// Test that retry delay grows exponentially up to max interval
+func TestRetryPolicyNextDelay(t *testing.T) {
+	policy := RetryPolicy{
+		InitialInterval: time.Minute,
+		MaxInterval:     time.Hour,
+		Multiplier:      2,
+	}
+	want := []time.Duration{time.Minute, 2 * time.Minute, 4 * time.Minute, 8 * time.Minute}
+	for i, w := range want {
+		got := policy.NextDelay(i+1, time.Time{})
+		if got != w {
+			t.Errorf("Bad delay after %d failures. Want: %s. Got: %s", i+1, w, got)
+		}
+	}
+	got := policy.NextDelay(20, time.Time{})
+	if got != time.Hour {
+		t.Errorf("Bad delay. Want: %s. Got: %s", time.Hour, got)
+	}
+}
+
+// Test that retry delay is shorter when certificate is about to expire
+func TestRetryPolicyNextDelayNearExpiry(t *testing.T) {
+	policy := RetryPolicy{
+		InitialInterval: time.Minute,
+		MaxInterval:     6 * time.Hour,
+		Multiplier:      2,
+	}
+	got := policy.NextDelay(20, time.Now().Add(10*time.Hour))
+	if got > time.Hour || got < 59*time.Minute {
+		t.Errorf("Delay should be limited to a tenth of remaining validity. Got: %s", got)
+	}
+	got = policy.NextDelay(20, time.Now().Add(-time.Hour))
+	if got != time.Minute {
+		t.Errorf("Delay should not be lower than initial interval. Got: %s", got)
+	}
+}
+
+// Test that jitter is applied within bounds
+func TestRetryPolicyJitter(t *testing.T) {
+	policy := RetryPolicy{
+		InitialInterval: time.Minute,
+		MaxInterval:     time.Hour,
+		Multiplier:      2,
+		Jitter:          0.5,
+	}
+	for i := 0; i < 100; i++ {
+		got := policy.NextDelay(1, time.Time{})
+		if got < 30*time.Second || got > 90*time.Second {
+			t.Fatalf("Delay out of jitter bounds: %s", got)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package acme
+
+import (
+	"crypto/ecdsa"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/quara-dev/letsgo-nats/configuration"
+)
+
+// Get paths of certificate and private key files of the primary certificate
+func CertificatePaths(config *configuration.UserConfig) (string, string) {
+	certFile := filepath.Join(config.OutputDirectory, config.Filename+".crt")
+	keyFile := filepath.Join(config.OutputDirectory, config.Filename+".key")
+	return certFile, keyFile
+}
+
+// Load key pairs of all certificates managed for user.
+//
+// ECDSA certificates come first, so that they are served to clients supporting
+// them, while RSA certificates are served to older clients in hybrid mode.
+func LoadCertificates(config *configuration.UserConfig) ([]tls.Certificate, error) {
+	certs := []tls.Certificate{}
+	for _, certConfig := range CertificateConfigs(config) {
+		cert, err := tls.LoadX509KeyPair(CertificatePaths(certConfig))
+		if err != nil {
+			return nil, err
+		}
+		cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+	sort.SliceStable(certs, func(i, j int) bool {
+		_, iECDSA := certs[i].PrivateKey.(*ecdsa.PrivateKey)
+		_, jECDSA := certs[j].PrivateKey.(*ecdsa.PrivateKey)
+		return iECDSA && !jECDSA
+	})
+	return certs, nil
+}
+
+// Check that all certificates managed for user exist and are currently valid
+func CheckCertificates(config *configuration.UserConfig) error {
+	certs, err := LoadCertificates(config)
+	if err != nil {
+		return err
+	}
+	return checkValidity(certs)
+}
+
+// Check that a certificate served by NATS server is currently valid and covers configured domains
+func CheckServedCertificate(cert *x509.Certificate, config *configuration.UserConfig) error {
+	now := time.Now()
+	if now.Before(cert.NotBefore) || now.After(cert.NotAfter) {
+		return errors.New(fmt.Sprintf("certificate for %s is not valid (not before %s, not after %s)", cert.Subject.CommonName, cert.NotBefore.Format(time.RFC3339), cert.NotAfter.Format(time.RFC3339)))
+	}
+	for _, domain := range config.Domains {
+		if err := cert.VerifyHostname(domain); err != nil {
+			return errors.New(fmt.Sprintf("certificate does not cover domain %s (SANs: %s)", domain, strings.Join(cert.DNSNames, ", ")))
+		}
+	}
+	return nil
+}
+
+// Check that certificates are within their validity period
+func checkValidity(certs []tls.Certificate) error {
+	if len(certs) == 0 {
+		return errors.New("no certificate loaded")
+	}
+	now := time.Now()
+	for _, cert := range certs {
+		if now.Before(cert.Leaf.NotBefore) || now.After(cert.Leaf.NotAfter) {
+			return errors.New(fmt.Sprintf("certificate for %s is not valid (not before %s, not after %s)", cert.Leaf.Subject.CommonName, cert.Leaf.NotBefore.Format(time.RFC3339), cert.Leaf.NotAfter.Format(time.RFC3339)))
+		}
+	}
+	return nil
+}
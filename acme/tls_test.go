@@ -0,0 +1,131 @@
+package acme
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-acme/lego/v4/certcrypto"
+
+	"github.com/quara-dev/letsgo-nats/configuration"
+)
+
+// Test that key pairs of all managed certificates are loaded
+func TestLoadCertificates(t *testing.T) {
+	config := &configuration.UserConfig{
+		OutputDirectory:    t.TempDir(),
+		Filename:           "example.com",
+		Domains:            []string{"example.com"},
+		CADirKeyType:       certcrypto.RSA2048,
+		AdditionalKeyTypes: []certcrypto.KeyType{certcrypto.EC256},
+	}
+	for _, certConfig := range CertificateConfigs(config) {
+		err := saveResource(newTestResource(t, "example.com"), certConfig)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+	}
+	certs, err := LoadCertificates(config)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if len(certs) != 2 {
+		t.Fatalf("Bad number of certificates. Want: 2. Got: %d", len(certs))
+	}
+	for _, cert := range certs {
+		if cert.Leaf == nil || cert.Leaf.Subject.CommonName != "example.com" {
+			t.Errorf("Certificate leaf was not parsed")
+		}
+	}
+}
+
+// Test that loading fails when a managed certificate is missing
+func TestLoadCertificatesMissing(t *testing.T) {
+	config := &configuration.UserConfig{
+		OutputDirectory: t.TempDir(),
+		Filename:        "example.com",
+		Domains:         []string{"example.com"},
+	}
+	_, err := LoadCertificates(config)
+	if err == nil {
+		t.Errorf("Missing certificate was not detected")
+	}
+}
+
+// Test that expired certificates are not usable
+func TestCheckCertificates(t *testing.T) {
+	config := &configuration.UserConfig{
+		OutputDirectory: t.TempDir(),
+		Filename:        "example.com",
+		Domains:         []string{"example.com"},
+	}
+	err := saveResource(newTestResource(t, "example.com"), config)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	err = CheckCertificates(config)
+	if err != nil {
+		t.Errorf(err.Error())
+	}
+	// Write an expired certificate matching private key
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(3),
+		Subject:      pkix.Name{CommonName: "example.com"},
+		DNSNames:     []string{"example.com"},
+		NotBefore:    time.Now().Add(-48 * time.Hour),
+		NotAfter:     time.Now().Add(-24 * time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	err = os.WriteFile(filepath.Join(config.OutputDirectory, "example.com.crt"), certcrypto.PEMEncode(certcrypto.DERCertificateBytes(der)), 0o600)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	err = os.WriteFile(filepath.Join(config.OutputDirectory, "example.com.key"), certcrypto.PEMEncode(key), 0o600)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	err = CheckCertificates(config)
+	if err == nil || !strings.Contains(err.Error(), "is not valid") {
+		t.Errorf("Expired certificate was not detected: %v", err)
+	}
+}
+
+// Test that served certificates are checked against configured domains
+func TestCheckServedCertificate(t *testing.T) {
+	config := &configuration.UserConfig{Domains: []string{"example.com", "*.example.com"}}
+	cert := newTestCertificate(t, time.Now().Add(-time.Hour), time.Now().Add(time.Hour), "example.com", "*.example.com")
+	if err := CheckServedCertificate(cert, config); err != nil {
+		t.Errorf(err.Error())
+	}
+
+	cert = newTestCertificate(t, time.Now().Add(-time.Hour), time.Now().Add(time.Hour), "example.com")
+	err := CheckServedCertificate(cert, config)
+	err_want := "certificate does not cover domain *.example.com (SANs: example.com)"
+	if err == nil {
+		t.Fatalf("Expected error. Want: %s. Got: nil", err_want)
+	}
+	if err.Error() != err_want {
+		t.Errorf("Bad error. Want: %s. Got: %s", err_want, err.Error())
+	}
+
+	cert = newTestCertificate(t, time.Now().Add(-2*time.Hour), time.Now().Add(-time.Hour), "example.com", "*.example.com")
+	err = CheckServedCertificate(cert, config)
+	if err == nil || !strings.HasPrefix(err.Error(), "certificate for example.com is not valid") {
+		t.Errorf("Expired certificate was not detected: %v", err)
+	}
+}
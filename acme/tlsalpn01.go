@@ -0,0 +1,100 @@
+package acme
+
+import (
+	"crypto/tls"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/go-acme/lego/v4/challenge/tlsalpn01"
+	"github.com/go-acme/lego/v4/log"
+)
+
+// In-process solver for TLS-ALPN-01 challenges
+//
+// Implements challenge.Provider. The listener is started when the first
+// challenge is presented, and shut down once all pending challenges are
+// cleaned up, so the address is only bound for the duration of the challenge.
+type TLSALPN01Solver struct {
+	Address string
+
+	mu           sync.Mutex
+	certificates map[string]*tls.Certificate
+	listener     net.Listener
+}
+
+// Create a new TLS-ALPN-01 solver listening on given address
+func NewTLSALPN01Solver(address string) *TLSALPN01Solver {
+	return &TLSALPN01Solver{Address: address, certificates: map[string]*tls.Certificate{}}
+}
+
+// Generate the challenge certificate and start listener if needed
+func (s *TLSALPN01Solver) Present(domain, token, keyAuth string) error {
+	// Generate the challenge certificate using the provided keyAuth and domain.
+	cert, err := tlsalpn01.ChallengeCert(domain, keyAuth)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.listener == nil {
+		// We must set that the `acme-tls/1` application level protocol is supported
+		// so that the protocol negotiation can succeed.
+		tlsConfig := &tls.Config{
+			NextProtos:     []string{tlsalpn01.ACMETLS1Protocol},
+			GetCertificate: s.getCertificate,
+		}
+		listener, err := tls.Listen("tcp", s.Address, tlsConfig)
+		if err != nil {
+			return errors.New("Could not start TLS server for challenge: " + err.Error())
+		}
+		s.listener = listener
+		go s.serve(listener)
+	}
+	s.certificates[strings.ToLower(domain)] = cert
+	return nil
+}
+
+// Remove the challenge certificate and stop listener when no challenge is pending
+func (s *TLSALPN01Solver) CleanUp(domain, token, keyAuth string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.certificates, strings.ToLower(domain))
+	if len(s.certificates) > 0 || s.listener == nil {
+		return nil
+	}
+	err := s.listener.Close()
+	s.listener = nil
+	return err
+}
+
+// Select challenge certificate according to server name
+func (s *TLSALPN01Solver) getCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cert, ok := s.certificates[strings.ToLower(hello.ServerName)]
+	if !ok {
+		return nil, errors.New("No challenge pending for server name: " + hello.ServerName)
+	}
+	log.Infof("[%s] Served TLS-ALPN challenge certificate", hello.ServerName)
+	return cert, nil
+}
+
+// Accept connections until listener is closed.
+//
+// The CA only needs to complete the TLS handshake, so connections are closed right after.
+func (s *TLSALPN01Solver) serve(listener net.Listener) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer conn.Close()
+			if tlsConn, ok := conn.(*tls.Conn); ok {
+				tlsConn.Handshake()
+			}
+		}()
+	}
+}
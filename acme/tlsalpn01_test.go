@@ -0,0 +1,43 @@
+package acme
+
+import (
+	"crypto/tls"
+	"testing"
+
+	"github.com/go-acme/lego/v4/challenge/tlsalpn01"
+)
+
+// Test that TLS-ALPN-01 solver only listens while challenges are pending
+func TestTLSALPN01SolverLifecycle(t *testing.T) {
+	solver := NewTLSALPN01Solver("127.0.0.1:0")
+	err := solver.Present("localhost", "token", "keyAuth")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	address := solver.listener.Addr().String()
+
+	conn, err := tls.Dial("tcp", address, &tls.Config{
+		ServerName:         "localhost",
+		NextProtos:         []string{tlsalpn01.ACMETLS1Protocol},
+		InsecureSkipVerify: true,
+	})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	state := conn.ConnectionState()
+	conn.Close()
+	if state.NegotiatedProtocol != tlsalpn01.ACMETLS1Protocol {
+		t.Errorf("got %q, wanted %q", state.NegotiatedProtocol, tlsalpn01.ACMETLS1Protocol)
+	}
+	if len(state.PeerCertificates) == 0 || state.PeerCertificates[0].DNSNames[0] != "localhost" {
+		t.Errorf("Challenge certificate was not served for localhost")
+	}
+
+	err = solver.CleanUp("localhost", "token", "keyAuth")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if solver.listener != nil {
+		t.Errorf("Listener should be closed once all challenges are cleaned up")
+	}
+}
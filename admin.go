@@ -0,0 +1,204 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+
+	"github.com/quara-dev/letsgo-nats/acme"
+	"github.com/quara-dev/letsgo-nats/configuration"
+)
+
+// Reply to a status request
+type statusReply struct {
+	Certificates        []certificateStatus `json:"certificates"`
+	LastAttempt         *time.Time          `json:"last_attempt,omitempty"`
+	LastError           string              `json:"last_error,omitempty"`
+	ConsecutiveFailures int                 `json:"consecutive_failures"`
+	Operation           *operationReply     `json:"operation,omitempty"`
+	Error               string              `json:"error,omitempty"`
+}
+
+// State of the last renew or revoke operation
+type operationReply struct {
+	Name       string     `json:"name"`
+	Running    bool       `json:"running"`
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	Revoked    bool       `json:"revoked,omitempty"`
+	Renewed    bool       `json:"renewed"`
+	Error      string     `json:"error,omitempty"`
+}
+
+// Certificate currently in use
+type certificateStatus struct {
+	Filename     string    `json:"filename"`
+	Domains      []string  `json:"domains"`
+	Issuer       string    `json:"issuer"`
+	SerialNumber string    `json:"serial_number"`
+	NotBefore    time.Time `json:"not_before"`
+	NotAfter     time.Time `json:"not_after"`
+}
+
+// Reply to a renew or revoke request. Operation runs in background once accepted.
+type acceptedReply struct {
+	Accepted bool   `json:"accepted"`
+	Error    string `json:"error,omitempty"`
+}
+
+// Body of a revoke request. Reason defaults to unspecified.
+type revokeRequest struct {
+	Reason string `json:"reason"`
+}
+
+// Service exposing certificate state and operations over NATS request/reply
+type adminService struct {
+	ns     *server.Server
+	config *configuration.UserConfig
+	task   *renewTask
+	nc     *nats.Conn
+}
+
+// Get the error message of an error, or an empty string
+func errorString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+// Send a JSON reply to a request
+func (s *adminService) reply(msg *nats.Msg, body interface{}) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		s.ns.Errorf("Failed to encode admin reply: %v", err)
+		return
+	}
+	if err := msg.Respond(data); err != nil {
+		s.ns.Warnf("Failed to send admin reply: %v", err)
+	}
+}
+
+func (s *adminService) handleStatus(msg *nats.Msg) {
+	status := s.task.status()
+	reply := statusReply{
+		Certificates:        []certificateStatus{},
+		LastError:           errorString(status.LastError),
+		ConsecutiveFailures: status.Failures,
+	}
+	if !status.LastAttempt.IsZero() {
+		reply.LastAttempt = &status.LastAttempt
+	}
+	if op := status.Operation; op != nil {
+		reply.Operation = &operationReply{
+			Name:      op.Name,
+			Running:   op.FinishedAt.IsZero(),
+			StartedAt: op.StartedAt,
+			Revoked:   op.Revoked,
+			Renewed:   op.Renewed,
+			Error:     errorString(op.Error),
+		}
+		if !op.FinishedAt.IsZero() {
+			reply.Operation.FinishedAt = &op.FinishedAt
+		}
+	}
+	certs, err := acme.CurrentCertificates(s.config)
+	if err != nil {
+		reply.Error = err.Error()
+	}
+	for _, cert := range certs {
+		reply.Certificates = append(reply.Certificates, certificateStatus{
+			Filename:     cert.Filename,
+			Domains:      cert.Domains,
+			Issuer:       cert.Issuer,
+			SerialNumber: cert.SerialNumber,
+			NotBefore:    cert.NotBefore,
+			NotAfter:     cert.NotAfter,
+		})
+	}
+	s.reply(msg, reply)
+}
+
+// Reply that an operation was accepted, or why it was not
+func (s *adminService) replyAccepted(msg *nats.Msg, err error) {
+	s.reply(msg, acceptedReply{Accepted: err == nil, Error: errorString(err)})
+}
+
+// Renewal is answered once started, since ACME orders take longer than request timeouts
+func (s *adminService) handleRenew(msg *nats.Msg) {
+	s.replyAccepted(msg, s.task.requestRenewal())
+}
+
+func (s *adminService) handleRevoke(msg *nats.Msg) {
+	request := revokeRequest{Reason: "unspecified"}
+	if len(msg.Data) > 0 {
+		if err := json.Unmarshal(msg.Data, &request); err != nil {
+			s.replyAccepted(msg, errors.New(fmt.Sprintf("Invalid revoke request: %v", err)))
+			return
+		}
+	}
+	reason, err := acme.ParseRevocationReason(request.Reason)
+	if err != nil {
+		s.replyAccepted(msg, err)
+		return
+	}
+	s.replyAccepted(msg, s.task.requestRevocation(reason))
+}
+
+// Check that admin connection belongs to NATS system account
+func checkSystemAccount(ns *server.Server, nc *nats.Conn) error {
+	sys := ns.SystemAccount()
+	if sys == nil {
+		return errors.New("NATS system account is not enabled")
+	}
+	cid, err := nc.GetClientID()
+	if err != nil {
+		return err
+	}
+	connz, err := ns.Connz(&server.ConnzOptions{CID: cid, Username: true})
+	if err != nil {
+		return err
+	}
+	if len(connz.Conns) != 1 || connz.Conns[0].Account != sys.Name {
+		return errors.New(fmt.Sprintf("Admin user must belong to NATS system account %s", sys.Name))
+	}
+	return nil
+}
+
+// Start admin service on NATS system account.
+//
+// The service connects to the embedded server in process, using admin user
+// credentials, and replies to requests on <ADMIN_SUBJECT>.status,
+// <ADMIN_SUBJECT>.renew and <ADMIN_SUBJECT>.revoke.
+func startAdminService(ns *server.Server, config *configuration.UserConfig, task *renewTask) error {
+	nc, err := nats.Connect("",
+		nats.InProcessServer(ns),
+		nats.UserInfo(config.AdminUser, config.AdminPassword),
+		nats.Name("letsgo-nats admin"),
+	)
+	if err != nil {
+		return err
+	}
+	if err := checkSystemAccount(ns, nc); err != nil {
+		nc.Close()
+		return err
+	}
+	s := &adminService{ns: ns, config: config, task: task, nc: nc}
+	handlers := map[string]nats.MsgHandler{
+		"status": s.handleStatus,
+		"renew":  s.handleRenew,
+		"revoke": s.handleRevoke,
+	}
+	for name, handler := range handlers {
+		if _, err := nc.Subscribe(config.AdminSubject+"."+name, handler); err != nil {
+			nc.Close()
+			return err
+		}
+	}
+	ns.Noticef("Admin service listening on %s.>", config.AdminSubject)
+	return nil
+}
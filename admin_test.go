@@ -0,0 +1,134 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+
+	"github.com/quara-dev/letsgo-nats/configuration"
+)
+
+// Start a NATS server with a system account and an application account
+func runTestAdminServer(t *testing.T) *server.Server {
+	configFile := writeTestNATSConfig(t, `
+listen: "127.0.0.1:-1"
+accounts {
+  SYS { users: [{user: admin, password: secret}] }
+  APP { users: [{user: app, password: secret}] }
+}
+system_account: SYS
+`)
+	opts, err := server.ProcessConfigFile(configFile)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	return runTestServer(t, opts)
+}
+
+// Create a configuration of admin service using admin user of system account
+func newTestAdminConfig(t *testing.T) *configuration.UserConfig {
+	config := newTestConfig(t)
+	config.AdminSubject = "letsgo.admin"
+	config.AdminUser = "admin"
+	config.AdminPassword = "secret"
+	return config
+}
+
+// Send a request to admin service and decode its reply
+func adminRequest(t *testing.T, nc *nats.Conn, subject string, data string, reply interface{}) {
+	msg, err := nc.Request(subject, []byte(data), 2*time.Second)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if err := json.Unmarshal(msg.Data, reply); err != nil {
+		t.Fatalf(err.Error())
+	}
+}
+
+// Test that status and operation requests are answered on system account
+func TestAdminService(t *testing.T) {
+	ns := runTestAdminServer(t)
+	config := newTestAdminConfig(t)
+	writeTestCertificate(t, config, time.Now().Add(-time.Hour), time.Now().Add(24*time.Hour))
+	task := &renewTask{
+		config:      config,
+		failures:    2,
+		lastAttempt: time.Now(),
+		lastError:   errors.New("boom"),
+		// Operations are rejected while an operation is running, without contacting ACME server
+		operation: &operationStatus{Name: "renew", StartedAt: time.Now()},
+	}
+	if err := startAdminService(ns, config, task); err != nil {
+		t.Fatalf(err.Error())
+	}
+	nc, err := nats.Connect(ns.ClientURL(), nats.UserInfo("admin", "secret"))
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	defer nc.Close()
+	status := statusReply{}
+	adminRequest(t, nc, "letsgo.admin.status", "", &status)
+	if status.Error != "" {
+		t.Fatalf(status.Error)
+	}
+	if len(status.Certificates) != 1 || status.Certificates[0].Filename != "example.com" || status.Certificates[0].Domains[0] != "example.com" {
+		t.Errorf("Bad certificates: %+v", status.Certificates)
+	}
+	if status.ConsecutiveFailures != 2 || status.LastError != "boom" || status.LastAttempt == nil {
+		t.Errorf("Bad renewal state: %d %s %v", status.ConsecutiveFailures, status.LastError, status.LastAttempt)
+	}
+	if status.Operation == nil || status.Operation.Name != "renew" || !status.Operation.Running {
+		t.Errorf("Bad operation: %+v", status.Operation)
+	}
+	tests := []struct {
+		name    string
+		subject string
+		data    string
+		err     string
+	}{
+		{"invalid request", "letsgo.admin.revoke", "{", "Invalid revoke request"},
+		{"invalid reason", "letsgo.admin.revoke", `{"reason": "bogus"}`, "bogus"},
+		{"default reason", "letsgo.admin.revoke", "", "Operation renew is already running"},
+		{"reason", "letsgo.admin.revoke", `{"reason": "keyCompromise"}`, "Operation renew is already running"},
+		{"renew", "letsgo.admin.renew", "", "Operation renew is already running"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			reply := acceptedReply{}
+			adminRequest(t, nc, test.subject, test.data, &reply)
+			if reply.Accepted || !strings.Contains(reply.Error, test.err) {
+				t.Errorf("Bad reply. Want: %s. Got: %v %s", test.err, reply.Accepted, reply.Error)
+			}
+		})
+	}
+}
+
+// Test that admin service refuses to start with a user which does not belong to system account
+func TestAdminServiceNonSystemUser(t *testing.T) {
+	ns := runTestAdminServer(t)
+	config := newTestAdminConfig(t)
+	config.AdminUser = "app"
+	err := startAdminService(ns, config, &renewTask{config: config})
+	err_want := "Admin user must belong to NATS system account SYS"
+	if err == nil || err.Error() != err_want {
+		t.Fatalf("Bad error. Want: %s. Got: %v", err_want, err)
+	}
+	// Application users cannot reach admin service running on system account
+	config.AdminUser = "admin"
+	if err := startAdminService(ns, config, &renewTask{config: config}); err != nil {
+		t.Fatalf(err.Error())
+	}
+	nc, err := nats.Connect(ns.ClientURL(), nats.UserInfo("app", "secret"))
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	defer nc.Close()
+	if _, err := nc.Request("letsgo.admin.status", nil, 200*time.Millisecond); err == nil {
+		t.Errorf("Admin service should not be reachable from application account")
+	}
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/quara-dev/letsgo-nats/acme"
+	"github.com/quara-dev/letsgo-nats/configuration"
+	"github.com/quara-dev/letsgo-nats/stores"
+)
+
+var certUsageStr = `
+Usage: letsgo-nats cert <command> [options]
+Commands:
+    status                           Show certificates stored in OUTPUT_DIRECTORY
+    history                          List certificate versions stored in OUTPUT_DIRECTORY
+    renew [--force]                  Renew certificates when renewal is due, or immediately with --force
+    revoke [--reason <reason>]       Revoke certificates (reason: unspecified, keyCompromise,
+                                     affiliationChanged, superseded or cessationOfOperation)
+`
+
+// Print certificates stored in output directory
+func printCertificateStatus(config *configuration.UserConfig) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for i, certConfig := range acme.CertificateConfigs(config) {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		certFile, keyFile := acme.CertificatePaths(certConfig)
+		fmt.Fprintf(w, "Certificate:\t%s\n", certFile)
+		fmt.Fprintf(w, "Private key:\t%s\n", keyFile)
+		cert, err := acme.ReadCertificate(certConfig)
+		if err != nil {
+			fmt.Fprintf(w, "Status:\t%v\n", err)
+			continue
+		}
+		fmt.Fprintf(w, "Domains:\t%s\n", strings.Join(cert.DNSNames, ", "))
+		fmt.Fprintf(w, "Key type:\t%s\n", acme.KeyTypeName(cert))
+		fmt.Fprintf(w, "Issuer:\t%s\n", cert.Issuer.CommonName)
+		fmt.Fprintf(w, "Serial:\t%s\n", cert.SerialNumber.Text(16))
+		fmt.Fprintf(w, "Fingerprint:\t%s\n", acme.Fingerprint(cert))
+		fmt.Fprintf(w, "Not before:\t%s\n", cert.NotBefore.Format(time.RFC3339))
+		fmt.Fprintf(w, "Not after:\t%s\n", cert.NotAfter.Format(time.RFC3339))
+		remaining := time.Until(cert.NotAfter)
+		switch {
+		case remaining <= 0:
+			fmt.Fprintf(w, "Status:\texpired\n")
+		case time.Now().Before(cert.NotBefore):
+			fmt.Fprintf(w, "Status:\tnot valid yet\n")
+		default:
+			fmt.Fprintf(w, "Status:\tvalid for %d days\n", int(remaining.Hours()/24))
+		}
+		if err := acme.CheckCertificateMatch(cert, certConfig); err != nil {
+			fmt.Fprintf(w, "Configuration:\t%v\n", err)
+		} else {
+			fmt.Fprintf(w, "Configuration:\tmatches\n")
+		}
+	}
+	return w.Flush()
+}
+
+// Print certificate versions stored in output directory
+func printCertificateHistory(config *configuration.UserConfig) error {
+	history, err := acme.CertificateHistory(config)
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tISSUED AT\tCURRENT\tFILENAME\tDOMAINS\tISSUER\tSERIAL\tNOT AFTER")
+	for _, version := range history {
+		current := ""
+		if version.Current {
+			current = "*"
+		}
+		for _, cert := range version.Certificates {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+				version.Version,
+				version.IssuedAt.Format(time.RFC3339),
+				current,
+				cert.Filename,
+				strings.Join(cert.Domains, ","),
+				cert.Issuer,
+				cert.SerialNumber,
+				cert.NotAfter.Format(time.RFC3339),
+			)
+		}
+	}
+	return w.Flush()
+}
+
+// Renew certificates, and commit renewed certificates since no server needs to load them first
+func renewCertificates(config *configuration.UserConfig, force bool) error {
+	var renewed bool
+	var err error
+	if force {
+		renewed, err = acme.ForceRenewCertificate(config)
+	} else {
+		renewed, err = acme.GetOrRenewCertificate(config)
+	}
+	if renewed {
+		if err := acme.CommitCertificate(config); err != nil {
+			fmt.Fprintf(os.Stderr, "letsgo-nats: failed to commit TLS certificates version: %v\n", err)
+		}
+		fmt.Println("Certificates renewed. Running NATS servers must be reloaded to use renewed certificates.")
+	} else if err == nil {
+		fmt.Println("Certificate renewal is not due yet. Use --force to renew certificates anyway.")
+	}
+	return err
+}
+
+// Revoke certificates
+func revokeCertificates(config *configuration.UserConfig, reason uint) error {
+	if err := acme.RevokeCertificate(config, reason); err != nil {
+		return err
+	}
+	fmt.Println("Certificates revoked. Use 'letsgo-nats cert renew --force' to replace them.")
+	return nil
+}
+
+// Run a certificate management command and return exit code
+func runCertCommand(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, certUsageStr)
+		return 2
+	}
+	fs := flag.NewFlagSet("cert "+args[0], flag.ContinueOnError)
+	fs.Usage = func() { fmt.Fprint(os.Stderr, certUsageStr) }
+	var force bool
+	var reason string
+	switch args[0] {
+	case "status", "history":
+	case "renew":
+		fs.BoolVar(&force, "force", false, "")
+	case "revoke":
+		fs.StringVar(&reason, "reason", "unspecified", "")
+	default:
+		fs.Usage()
+		return 2
+	}
+	if err := fs.Parse(args[1:]); err != nil || fs.NArg() > 0 {
+		if err == nil {
+			fs.Usage()
+		}
+		return 2
+	}
+	// Check revocation reason before configuration is processed
+	var reasonCode uint
+	if args[0] == "revoke" {
+		code, err := acme.ParseRevocationReason(reason)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "letsgo-nats: %v\n", err)
+			return 2
+		}
+		reasonCode = code
+	}
+	stores := stores.DefaultStores()
+	config, err := configuration.NewUserConfig(&stores)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "letsgo-nats: %v\n", err)
+		return 1
+	}
+	switch args[0] {
+	case "status":
+		err = printCertificateStatus(config)
+	case "history":
+		err = printCertificateHistory(config)
+	case "renew":
+		err = renewCertificates(config, force)
+	case "revoke":
+		err = revokeCertificates(config, reasonCode)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "letsgo-nats: %v\n", err)
+		return 1
+	}
+	return 0
+}
@@ -18,39 +18,85 @@ import (
 	"github.com/go-acme/lego/v4/certcrypto"
 	"github.com/quara-dev/letsgo-nats/constants"
 	"github.com/quara-dev/letsgo-nats/stores"
+	"golang.org/x/exp/slices"
 )
 
 type RawUserConfig struct {
-	AccountEmail       string
-	AccountKeyFile     string
-	TOSAgreed          string
-	CADir              string
-	KeyType            string
-	Domains            string
-	Filename           string
-	OutputDirectory    string
-	DisableCP          string
-	DNSTimeout         string
-	DNSResolver        string
-	DNSAuthToken       string
-	DNSAuthTokenFile   string
-	DNSAuthTokenVault  string
-	DNSAuthTokenSecret string
+	AccountEmail    string
+	AccountKeyFile  string
+	TOSAgreed       string
+	CADir           string
+	KeyType         string
+	Domains         string
+	Filename        string
+	OutputDirectory string
+	OutputRetention string
+	DisableCP       string
+	DNSTimeout      string
+	DNSResolver     string
+	DNSProvider     string
+	DNSCredentials  map[string]RawSecret
+	Challenge       string
+	HTTPAddress     string
+	TLSAddress      string
+	RetryInitial    string
+	RetryMax        string
+	RetryMultiplier string
+	RetryJitter     string
+	RenewPercent    string
+	ReuseKey        string
+	PreferredChain  string
+	EABKid          RawSecret
+	EABHmac         RawSecret
+	TLSListeners    string
+	AdminSubject    string
+	AdminUser       string
+	AdminPassword   RawSecret
+	EventsSubject   string
+	EventsUser      string
+	EventsPassword  RawSecret
+	MetricsAddress  string
+	HealthAddress   string
 }
 
 type UserConfig struct {
-	Email                string
-	Key                  crypto.PrivateKey
-	CADirURL             string
-	CADirKeyType         certcrypto.KeyType
-	TermsOfServiceAgreed bool
-	Domains              []string
-	Filename             string
-	OutputDirectory      string
-	AuthToken            string
-	DisableCP            bool
-	DNSResolvers         []string
-	DNSTimeout           time.Duration
+	Email                 string
+	AccountKeyFile        string
+	Key                   crypto.PrivateKey
+	CADirURL              string
+	CADirKeyType          certcrypto.KeyType
+	AdditionalKeyTypes    []certcrypto.KeyType
+	TermsOfServiceAgreed  bool
+	Domains               []string
+	Filename              string
+	OutputDirectory       string
+	OutputRetention       int
+	DNSProvider           string
+	DNSCredentials        map[string]string
+	DisableCP             bool
+	DNSResolvers          []string
+	DNSTimeout            time.Duration
+	Challenge             string
+	HTTPAddress           string
+	TLSAddress            string
+	RetryInitialInterval  time.Duration
+	RetryMaxInterval      time.Duration
+	RetryMultiplier       float64
+	RetryJitter           float64
+	RenewRemainingPercent float64
+	ReusePrivateKey       bool
+	PreferredChain        string
+	EABKid                string
+	EABHmac               string
+	TLSListeners          []string
+	AdminSubject          string
+	AdminUser             string
+	AdminPassword         string
+	EventsSubject         string
+	EventsUser            string
+	EventsPassword        string
+	MetricsAddress        string
+	HealthAddress         string
 }
 
 // Parse domains from string
@@ -94,6 +140,11 @@ func (c *RawUserConfig) getCADir() (string, error) {
 	// This CA URL is configured for a local dev instance of Boulder running in Docker in a VM.
 	case constants.ACME_TEST_ENV:
 		return constants.ACME_TEST_CA_DIR, nil
+	// These CAs require External Account Binding
+	case constants.ACME_ZEROSSL_ENV:
+		return constants.ACME_ZEROSSL_CA_DIR, nil
+	case constants.ACME_GOOGLE_ENV:
+		return constants.ACME_GOOGLE_CA_DIR, nil
 	default:
 		if !(strings.HasPrefix(c.CADir, "http://") || strings.HasPrefix(c.CADir, "https://")) {
 			return "", errors.New(fmt.Sprintf("Invalid CA directory: %s", c.CADir))
@@ -138,21 +189,51 @@ func (c *RawUserConfig) getAccountKey() (crypto.PrivateKey, error) {
 	return privateKey, nil
 }
 
-func (c *RawUserConfig) getKeyType() (certcrypto.KeyType, error) {
-	switch c.KeyType {
+func parseKeyType(keyType string) (certcrypto.KeyType, error) {
+	switch strings.ToUpper(strings.TrimSpace(keyType)) {
 	case constants.KEY_TYPE_RSA2048:
 		return certcrypto.RSA2048, nil
 	case constants.KEY_TYPE_RSA4096:
 		return certcrypto.RSA4096, nil
 	case constants.KEY_TYPE_RSA8192:
 		return certcrypto.RSA8192, nil
+	case constants.KEY_TYPE_EC256:
+		return certcrypto.EC256, nil
+	case constants.KEY_TYPE_EC384:
+		return certcrypto.EC384, nil
 	default:
-		return certcrypto.RSA2048, errors.New(fmt.Sprintf("Invalid key type. Allowed values are '%s', '%s' and '%s'.", constants.KEY_TYPE_RSA2048, constants.KEY_TYPE_RSA4096, constants.KEY_TYPE_RSA8192))
+		return certcrypto.RSA2048, errors.New(fmt.Sprintf("Invalid key type. Allowed values are '%s', '%s', '%s', '%s' and '%s'.", constants.KEY_TYPE_RSA2048, constants.KEY_TYPE_RSA4096, constants.KEY_TYPE_RSA8192, constants.KEY_TYPE_EC256, constants.KEY_TYPE_EC384))
 	}
 }
 
+func (c *RawUserConfig) getKeyType() (certcrypto.KeyType, error) {
+	return parseKeyType(c.KeyType)
+}
+
+// Parse key types from comma-separated string.
+//
+// When several key types are provided (hybrid mode), a certificate is
+// issued for each key type. First key type is the primary key type.
+func (c *RawUserConfig) getKeyTypes() ([]certcrypto.KeyType, error) {
+	keyTypes := []certcrypto.KeyType{}
+	for _, value := range strings.Split(c.KeyType, ",") {
+		keyType, err := parseKeyType(value)
+		if err != nil {
+			return keyTypes, err
+		}
+		if slices.Contains(keyTypes, keyType) {
+			return keyTypes, errors.New(fmt.Sprintf("Duplicate key type found in %s environment variable: %s", constants.LE_CRT_KEY_TYPE, value))
+		}
+		keyTypes = append(keyTypes, keyType)
+	}
+	return keyTypes, nil
+}
+
 func (c *RawUserConfig) getFilename(domains []string) (string, error) {
 	if c.Filename == "" {
+		if len(domains) == 0 {
+			return "", errors.New(fmt.Sprintf("A file name must be provided through %s environment variable when %s is not set", constants.FILENAME, constants.DOMAINS))
+		}
 		defaultName, err := sanitizeDomain(domains[0])
 		if err != nil {
 			return "", err
@@ -187,49 +268,175 @@ func (c *RawUserConfig) getDisableCPOption() (bool, error) {
 	return option, nil
 }
 
-func (c *RawUserConfig) getDNSAuthToken(storage *stores.Stores) (string, error) {
-	// Check that token is not empty
-	if c.DNSAuthToken != "" {
-		return c.DNSAuthToken, nil
-	}
-	// Check if token should be fetched from file
-	if c.DNSAuthTokenFile != "" {
-		filestore := storage.GetFileStore()
-		return filestore.GetToken(c.DNSAuthTokenFile)
+func (c *RawUserConfig) getChallenge() (string, error) {
+	challenge := strings.ToLower(c.Challenge)
+	switch challenge {
+	case constants.ACME_CHALLENGE_DNS01, constants.ACME_CHALLENGE_HTTP01, constants.ACME_CHALLENGE_TLSALPN01:
+		return challenge, nil
+	default:
+		return "", errors.New(fmt.Sprintf("Invalid ACME challenge. Allowed values are '%s', '%s' and '%s'.", constants.ACME_CHALLENGE_DNS01, constants.ACME_CHALLENGE_HTTP01, constants.ACME_CHALLENGE_TLSALPN01))
 	}
-	// Check if token should be fetched from vault
-	if c.DNSAuthTokenVault != "" {
-		uri, err := c.getDNSAuthTokenVaultURI()
-		if err != nil {
-			return "", err
+}
+
+// Parse NATS listeners using managed certificates from a comma-separated list
+func (c *RawUserConfig) getTLSListeners() ([]string, error) {
+	listeners := []string{}
+	allowed := []string{
+		constants.TLS_LISTENER_CLIENT,
+		constants.TLS_LISTENER_WEBSOCKET,
+		constants.TLS_LISTENER_MQTT,
+		constants.TLS_LISTENER_LEAFNODE,
+		constants.TLS_LISTENER_GATEWAY,
+		constants.TLS_LISTENER_HTTPS,
+	}
+	if strings.TrimSpace(c.TLSListeners) == "" {
+		return listeners, nil
+	}
+	for _, value := range strings.Split(c.TLSListeners, ",") {
+		listener := strings.ToLower(strings.TrimSpace(value))
+		if !slices.Contains(allowed, listener) {
+			return nil, errors.New(fmt.Sprintf("Invalid listener found in %s environment variable: %s. Allowed values are '%s'.", constants.TLS_LISTENERS, value, strings.Join(allowed, "', '")))
 		}
-		secret, err := c.getDNSAuthTokenSecretName()
-		if err != nil {
-			return "", err
+		if !slices.Contains(listeners, listener) {
+			listeners = append(listeners, listener)
 		}
-		keyvault := storage.GetKeyvaultStore()
-		return keyvault.GetToken(uri, secret)
 	}
-	// Return an error
-	return "", errors.New(fmt.Sprintf("Invalid DNS auth token. Use one of '%s', '%s' or '%s' env variable", constants.DNS_AUTH_TOKEN_VAULT, constants.DNS_AUTH_TOKEN_FILE, constants.DNS_AUTH_TOKEN))
+	// NATS serves HTTPS monitoring with client TLS configuration
+	if slices.Contains(listeners, constants.TLS_LISTENER_HTTPS) && !slices.Contains(listeners, constants.TLS_LISTENER_CLIENT) {
+		return nil, errors.New(fmt.Sprintf("HTTPS monitoring uses client TLS configuration. '%s' must also be listed in %s environment variable.", constants.TLS_LISTENER_CLIENT, constants.TLS_LISTENERS))
+	}
+	return listeners, nil
+}
+
+func (c *RawUserConfig) getHTTPAddress() (string, error) {
+	return getListenAddress(c.HTTPAddress, constants.HTTP_CHALLENGE_ADDRESS)
+}
+
+func (c *RawUserConfig) getTLSAddress() (string, error) {
+	return getListenAddress(c.TLSAddress, constants.TLS_CHALLENGE_ADDRESS)
+}
+
+func (c *RawUserConfig) getMetricsAddress() (string, error) {
+	// Metrics listener is optional
+	if strings.TrimSpace(c.MetricsAddress) == "" {
+		return "", nil
+	}
+	return getListenAddress(strings.TrimSpace(c.MetricsAddress), constants.METRICS_ADDRESS)
 }
 
-func (c *RawUserConfig) getDNSAuthTokenVaultURI() (string, error) {
-	if c.DNSAuthTokenVault == "" {
-		return "", errors.New(fmt.Sprintf("Invalid Keyvault URI: %s", c.DNSAuthTokenVault))
+func (c *RawUserConfig) getHealthAddress() (string, error) {
+	// Health listener is optional
+	if strings.TrimSpace(c.HealthAddress) == "" {
+		return "", nil
 	}
-	if strings.HasPrefix(c.DNSAuthTokenVault, "https://") {
-		return c.DNSAuthTokenVault, nil
-	} else {
-		return fmt.Sprintf("https://%s.vault.azure.net/", c.DNSAuthTokenVault), nil
+	return getListenAddress(strings.TrimSpace(c.HealthAddress), constants.HEALTH_ADDRESS)
+}
+
+func (c *RawUserConfig) getRetryIntervals() (time.Duration, time.Duration, error) {
+	initial, err := strconv.ParseFloat(c.RetryInitial, 64)
+	if err != nil || initial <= 0 {
+		return 0, 0, errors.New(fmt.Sprintf("Invalid retry interval found in %s environment variable: %s", constants.RETRY_INITIAL_INTERVAL, c.RetryInitial))
+	}
+	max, err := strconv.ParseFloat(c.RetryMax, 64)
+	if err != nil || max < initial {
+		return 0, 0, errors.New(fmt.Sprintf("Invalid retry interval found in %s environment variable: %s. It must be greater than %s.", constants.RETRY_MAX_INTERVAL, c.RetryMax, constants.RETRY_INITIAL_INTERVAL))
+	}
+	return time.Duration(initial * float64(time.Second)), time.Duration(max * float64(time.Second)), nil
+}
+
+func (c *RawUserConfig) getRetryMultiplier() (float64, error) {
+	multiplier, err := strconv.ParseFloat(c.RetryMultiplier, 64)
+	if err != nil || multiplier < 1 {
+		return 0, errors.New(fmt.Sprintf("Invalid retry multiplier found in %s environment variable: %s", constants.RETRY_MULTIPLIER, c.RetryMultiplier))
+	}
+	return multiplier, nil
+}
+
+func (c *RawUserConfig) getRetryJitter() (float64, error) {
+	jitter, err := strconv.ParseFloat(c.RetryJitter, 64)
+	if err != nil || jitter < 0 || jitter > 1 {
+		return 0, errors.New(fmt.Sprintf("Invalid retry jitter found in %s environment variable: %s. It must be between 0 and 1.", constants.RETRY_JITTER, c.RetryJitter))
+	}
+	return jitter, nil
+}
+
+func (c *RawUserConfig) getRenewRemainingPercent() (float64, error) {
+	percent, err := strconv.ParseFloat(c.RenewPercent, 64)
+	if err != nil || percent <= 0 || percent >= 100 {
+		return 0, errors.New(fmt.Sprintf("Invalid percentage found in %s environment variable: %s. It must be between 0 and 100.", constants.RENEW_REMAINING_PERCENT, c.RenewPercent))
+	}
+	return percent, nil
+}
+
+func (c *RawUserConfig) getReusePrivateKey() (bool, error) {
+	option, err := strconv.ParseBool(c.ReuseKey)
+	if err != nil {
+		return false, errors.New(fmt.Sprintf("Invalid boolean found in %s environment variable: %s", constants.REUSE_PRIVATE_KEY, c.ReuseKey))
 	}
+	return option, nil
+}
+
+func (c *RawUserConfig) getExternalAccountBinding(storage *stores.Stores) (string, string, error) {
+	// External Account Binding is optional
+	if c.EABKid.isEmpty() && c.EABHmac.isEmpty() {
+		return "", "", nil
+	}
+	kid, err := c.EABKid.resolve(storage, constants.EAB_KID, "EAB key identifier")
+	if err != nil {
+		return "", "", err
+	}
+	hmac, err := c.EABHmac.resolve(storage, constants.EAB_HMAC, "EAB HMAC key")
+	if err != nil {
+		return "", "", err
+	}
+	return kid, hmac, nil
+}
+
+func (c *RawUserConfig) getAdminService(storage *stores.Stores) (string, string, string, error) {
+	// Admin service is optional
+	user := strings.TrimSpace(c.AdminUser)
+	if user == "" {
+		return "", "", "", nil
+	}
+	subject, err := parseSubject(c.AdminSubject, constants.ADMIN_SUBJECT)
+	if err != nil {
+		return "", "", "", err
+	}
+	password, err := c.AdminPassword.resolve(storage, constants.ADMIN_PASSWORD, "admin password")
+	if err != nil {
+		return "", "", "", err
+	}
+	return subject, user, password, nil
+}
+
+func (c *RawUserConfig) getEventsPublisher(storage *stores.Stores) (string, string, string, error) {
+	// Events are optional
+	if strings.TrimSpace(c.EventsSubject) == "" {
+		return "", "", "", nil
+	}
+	subject, err := parseSubject(c.EventsSubject, constants.EVENTS_SUBJECT)
+	if err != nil {
+		return "", "", "", err
+	}
+	// Credentials are only needed when NATS server requires authentication
+	user := strings.TrimSpace(c.EventsUser)
+	if user == "" {
+		return subject, "", "", nil
+	}
+	password, err := c.EventsPassword.resolve(storage, constants.EVENTS_PASSWORD, "events password")
+	if err != nil {
+		return "", "", "", err
+	}
+	return subject, user, password, nil
 }
 
-func (c *RawUserConfig) getDNSAuthTokenSecretName() (string, error) {
-	if c.DNSAuthTokenSecret == "" {
-		return "", errors.New(fmt.Sprintf("Invalid DNS auth token: %s", c.DNSAuthTokenSecret))
+// Parse a NATS subject without wildcards
+func parseSubject(value string, env string) (string, error) {
+	subject := strings.TrimSpace(value)
+	if subject == "" || strings.ContainsAny(subject, " \t*>") || strings.HasPrefix(subject, ".") || strings.HasSuffix(subject, ".") || strings.Contains(subject, "..") {
+		return "", errors.New(fmt.Sprintf("Invalid subject found in %s environment variable: %s. It must be a NATS subject without wildcards.", env, value))
 	}
-	return c.DNSAuthTokenSecret, nil
+	return subject, nil
 }
 
 func (c *RawUserConfig) getOutputDirectory() (string, error) {
@@ -244,6 +451,14 @@ func (c *RawUserConfig) getOutputDirectory() (string, error) {
 	return dir, nil
 }
 
+func (c *RawUserConfig) getOutputRetention() (int, error) {
+	retention, err := strconv.Atoi(c.OutputRetention)
+	if err != nil || retention < 1 {
+		return 0, errors.New(fmt.Sprintf("Invalid number of versions found in %s environment variable: %s. It must be a positive integer.", constants.OUTPUT_RETENTION, c.OutputRetention))
+	}
+	return retention, nil
+}
+
 func (c *RawUserConfig) parse(storage *stores.Stores) (*UserConfig, error) {
 	config := &UserConfig{}
 
@@ -285,6 +500,7 @@ func (c *RawUserConfig) parse(storage *stores.Stores) (*UserConfig, error) {
 		return config, err
 	} else {
 		config.Key = accountKey
+		config.AccountKeyFile = c.AccountKeyFile
 	}
 
 	// Parsa CA directory
@@ -295,12 +511,22 @@ func (c *RawUserConfig) parse(storage *stores.Stores) (*UserConfig, error) {
 		config.CADirURL = caDir
 	}
 
-	// Parse key type
-	keyType, err := c.getKeyType()
+	// Parse External Account Binding
+	kid, hmac, err := c.getExternalAccountBinding(storage)
 	if err != nil {
 		return config, err
 	} else {
-		config.CADirKeyType = keyType
+		config.EABKid = kid
+		config.EABHmac = hmac
+	}
+
+	// Parse key types
+	keyTypes, err := c.getKeyTypes()
+	if err != nil {
+		return config, err
+	} else {
+		config.CADirKeyType = keyTypes[0]
+		config.AdditionalKeyTypes = keyTypes[1:]
 	}
 
 	// Parse DNS resolvers
@@ -335,35 +561,242 @@ func (c *RawUserConfig) parse(storage *stores.Stores) (*UserConfig, error) {
 		config.OutputDirectory = outputDirectory
 	}
 
-	// Parse dns auth token
-	token, err := c.getDNSAuthToken(storage)
+	// Parse number of certificate versions kept in output directory
+	retention, err := c.getOutputRetention()
+	if err != nil {
+		return config, err
+	} else {
+		config.OutputRetention = retention
+	}
+
+	// Parse retry policy
+	initial, max, err := c.getRetryIntervals()
+	if err != nil {
+		return config, err
+	} else {
+		config.RetryInitialInterval = initial
+		config.RetryMaxInterval = max
+	}
+	multiplier, err := c.getRetryMultiplier()
+	if err != nil {
+		return config, err
+	} else {
+		config.RetryMultiplier = multiplier
+	}
+	jitter, err := c.getRetryJitter()
 	if err != nil {
 		return config, err
 	} else {
-		config.AuthToken = token
+		config.RetryJitter = jitter
+	}
+
+	// Parse renewal threshold used when CA does not support renewal information
+	percent, err := c.getRenewRemainingPercent()
+	if err != nil {
+		return config, err
+	} else {
+		config.RenewRemainingPercent = percent
+	}
+
+	// Parse private key reuse option
+	reuseKey, err := c.getReusePrivateKey()
+	if err != nil {
+		return config, err
+	} else {
+		config.ReusePrivateKey = reuseKey
+	}
+
+	// Preferred chain is the common name of the root of the chain, any value is accepted
+	config.PreferredChain = strings.TrimSpace(c.PreferredChain)
+
+	// Parse NATS listeners using managed certificates
+	listeners, err := c.getTLSListeners()
+	if err != nil {
+		return config, err
+	} else {
+		config.TLSListeners = listeners
+	}
+
+	// Parse admin service
+	subject, user, password, err := c.getAdminService(storage)
+	if err != nil {
+		return config, err
+	} else {
+		config.AdminSubject = subject
+		config.AdminUser = user
+		config.AdminPassword = password
+	}
+
+	// Parse lifecycle events publisher
+	eventsSubject, eventsUser, eventsPassword, err := c.getEventsPublisher(storage)
+	if err != nil {
+		return config, err
+	} else {
+		config.EventsSubject = eventsSubject
+		config.EventsUser = eventsUser
+		config.EventsPassword = eventsPassword
+	}
+
+	// Parse metrics listener address
+	metricsAddress, err := c.getMetricsAddress()
+	if err != nil {
+		return config, err
+	} else {
+		config.MetricsAddress = metricsAddress
+	}
+
+	// Parse health listener address
+	healthAddress, err := c.getHealthAddress()
+	if err != nil {
+		return config, err
+	} else {
+		config.HealthAddress = healthAddress
+	}
+
+	// Parse ACME challenge
+	challenge, err := c.getChallenge()
+	if err != nil {
+		return config, err
+	} else {
+		config.Challenge = challenge
+	}
+
+	switch challenge {
+	case constants.ACME_CHALLENGE_HTTP01:
+		// Parse HTTP challenge address
+		address, err := c.getHTTPAddress()
+		if err != nil {
+			return config, err
+		} else {
+			config.HTTPAddress = address
+		}
+	case constants.ACME_CHALLENGE_TLSALPN01:
+		// Parse TLS challenge address
+		address, err := c.getTLSAddress()
+		if err != nil {
+			return config, err
+		} else {
+			config.TLSAddress = address
+		}
+	case constants.ACME_CHALLENGE_DNS01:
+		// Parse DNS provider
+		provider, err := c.getDNSProvider()
+		if err != nil {
+			return config, err
+		} else {
+			config.DNSProvider = provider
+		}
+
+		// Parse DNS provider credentials
+		credentials, err := c.getDNSCredentials(storage, provider)
+		if err != nil {
+			return config, err
+		} else {
+			config.DNSCredentials = credentials
+		}
 	}
 
 	return config, nil
 }
 
 func NewRawUserConfig() *RawUserConfig {
+	provider := getEnv(constants.DNS_PROVIDER, constants.DEFAULT_DNS_PROVIDER)
 	return &RawUserConfig{
-		AccountEmail:       getEnv(constants.ACCOUNT_EMAIL, ""),
-		AccountKeyFile:     getEnv(constants.ACCOUNT_KEY_FILE, constants.DEFAULT_ACCOUNT_KEY_FILE),
-		TOSAgreed:          getEnv(constants.LE_TOS_AGREED, constants.DEFAULT_LE_TOS_AGREED),
-		CADir:              getEnv(constants.CA_DIR, constants.DEFAULT_CA_DIR),
-		KeyType:            getEnv(constants.LE_CRT_KEY_TYPE, constants.DEFAULT_LE_CRT_KEY_TYPE),
-		Domains:            getEnv(constants.DOMAINS, ""),
-		Filename:           getEnv(constants.FILENAME, ""),
-		DisableCP:          getEnv(constants.DISABLE_CP, constants.DEFAULT_DISABLE_CP),
-		DNSTimeout:         getEnv(constants.DNS_TIMEOUT, "0"),
-		DNSResolver:        getEnv(constants.DNS_RESOLVERS, ""),
-		DNSAuthToken:       getEnv(constants.DNS_AUTH_TOKEN, ""),
-		DNSAuthTokenFile:   getEnv(constants.DNS_AUTH_TOKEN_FILE, ""),
-		DNSAuthTokenVault:  getEnv(constants.DNS_AUTH_TOKEN_VAULT, ""),
-		DNSAuthTokenSecret: getEnv(constants.DNS_AUTH_TOKEN_SECRET, constants.DEFAULT_DNS_AUTH_TOKEN_SECRET),
-		OutputDirectory:    getEnv(constants.OUTPUT_DIRECTORY, "./"),
+		AccountEmail:    getEnv(constants.ACCOUNT_EMAIL, ""),
+		AccountKeyFile:  getEnv(constants.ACCOUNT_KEY_FILE, constants.DEFAULT_ACCOUNT_KEY_FILE),
+		TOSAgreed:       getEnv(constants.LE_TOS_AGREED, constants.DEFAULT_LE_TOS_AGREED),
+		CADir:           getEnv(constants.CA_DIR, constants.DEFAULT_CA_DIR),
+		KeyType:         getEnv(constants.LE_CRT_KEY_TYPE, constants.DEFAULT_LE_CRT_KEY_TYPE),
+		Domains:         getEnv(constants.DOMAINS, ""),
+		Filename:        getEnv(constants.FILENAME, ""),
+		DisableCP:       getEnv(constants.DISABLE_CP, constants.DEFAULT_DISABLE_CP),
+		DNSTimeout:      getEnv(constants.DNS_TIMEOUT, "0"),
+		DNSResolver:     getEnv(constants.DNS_RESOLVERS, ""),
+		DNSProvider:     provider,
+		DNSCredentials:  getRawDNSCredentials(strings.ToLower(provider)),
+		OutputDirectory: getEnv(constants.OUTPUT_DIRECTORY, "./"),
+		OutputRetention: getEnv(constants.OUTPUT_RETENTION, constants.DEFAULT_OUTPUT_RETENTION),
+		Challenge:       getEnv(constants.ACME_CHALLENGE, constants.DEFAULT_ACME_CHALLENGE),
+		HTTPAddress:     getEnv(constants.HTTP_CHALLENGE_ADDRESS, constants.DEFAULT_HTTP_CHALLENGE_ADDRESS),
+		TLSAddress:      getEnv(constants.TLS_CHALLENGE_ADDRESS, constants.DEFAULT_TLS_CHALLENGE_ADDRESS),
+		RetryInitial:    getEnv(constants.RETRY_INITIAL_INTERVAL, constants.DEFAULT_RETRY_INITIAL_INTERVAL),
+		RetryMax:        getEnv(constants.RETRY_MAX_INTERVAL, constants.DEFAULT_RETRY_MAX_INTERVAL),
+		RetryMultiplier: getEnv(constants.RETRY_MULTIPLIER, constants.DEFAULT_RETRY_MULTIPLIER),
+		RetryJitter:     getEnv(constants.RETRY_JITTER, constants.DEFAULT_RETRY_JITTER),
+		RenewPercent:    getEnv(constants.RENEW_REMAINING_PERCENT, constants.DEFAULT_RENEW_REMAINING_PERCENT),
+		ReuseKey:        getEnv(constants.REUSE_PRIVATE_KEY, constants.DEFAULT_REUSE_PRIVATE_KEY),
+		PreferredChain:  getEnv(constants.PREFERRED_CHAIN, ""),
+		EABKid:          getRawSecret(constants.EAB_KID, "eab-kid"),
+		EABHmac:         getRawSecret(constants.EAB_HMAC, "eab-hmac"),
+		TLSListeners:    getEnv(constants.TLS_LISTENERS, ""),
+		AdminSubject:    getEnv(constants.ADMIN_SUBJECT, constants.DEFAULT_ADMIN_SUBJECT),
+		AdminUser:       getEnv(constants.ADMIN_USER, ""),
+		AdminPassword:   getRawSecret(constants.ADMIN_PASSWORD, "admin-password"),
+		EventsSubject:   getEnv(constants.EVENTS_SUBJECT, ""),
+		EventsUser:      getEnv(constants.EVENTS_USER, ""),
+		EventsPassword:  getRawSecret(constants.EVENTS_PASSWORD, "events-password"),
+		MetricsAddress:  getEnv(constants.METRICS_ADDRESS, ""),
+		HealthAddress:   getEnv(constants.HEALTH_ADDRESS, ""),
+	}
+}
+
+// Parse configuration of certificate files only.
+//
+// Unlike parse, this does not read secrets, nor generate account key, nor
+// create output directory, so it can be used offline (e.g. to test configuration).
+// Domains are only required when filename is not set.
+func (c *RawUserConfig) parseOutput() (*UserConfig, error) {
+	config := &UserConfig{}
+
+	// Parse domains, used to derive filename
+	if c.Domains != "" {
+		domains, err := c.getDomains()
+		if err != nil {
+			return config, err
+		} else {
+			config.Domains = domains
+		}
+	}
+
+	// Parse filename
+	name, err := c.getFilename(config.Domains)
+	if err != nil {
+		return config, err
+	} else {
+		config.Filename = name
 	}
+
+	// Parse key types
+	keyTypes, err := c.getKeyTypes()
+	if err != nil {
+		return config, err
+	} else {
+		config.CADirKeyType = keyTypes[0]
+		config.AdditionalKeyTypes = keyTypes[1:]
+	}
+
+	// Parse output directory, without creating it
+	outputDirectory, err := filepath.Abs(c.OutputDirectory)
+	if err != nil {
+		return config, err
+	} else {
+		config.OutputDirectory = outputDirectory
+	}
+
+	// Parse NATS listeners using managed certificates
+	listeners, err := c.getTLSListeners()
+	if err != nil {
+		return config, err
+	} else {
+		config.TLSListeners = listeners
+	}
+
+	return config, nil
+}
+
+func NewOutputConfig() (*UserConfig, error) {
+	config := NewRawUserConfig()
+	return config.parseOutput()
 }
 
 func NewUserConfig(storage *stores.Stores) (*UserConfig, error) {
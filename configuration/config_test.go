@@ -14,6 +14,15 @@ import (
 	"golang.org/x/exp/slices"
 )
 
+// Credentials of the default DNS provider.
+//
+// DNS providers are registered by the acme package, which is not imported in tests.
+var testDNSCredential = DNSCredential{Name: "AUTH_TOKEN", DefaultSecret: constants.DEFAULT_DNS_AUTH_TOKEN_SECRET}
+
+func init() {
+	RegisterDNSCredentials(constants.DEFAULT_DNS_PROVIDER, testDNSCredential)
+}
+
 // Test that getOrCreateAccountKey function behaves as expected
 func TestGetAccountKey(t *testing.T) {
 	dir := t.TempDir()
@@ -63,15 +72,56 @@ func TestGetKeyType(t *testing.T) {
 		t.Errorf(fmt.Sprintf("Expected RSA8192 but got %s", typ))
 	}
 
+	c = RawUserConfig{KeyType: "EC256"}
+	typ, err = c.getKeyType()
+	if err != nil {
+		t.Errorf(err.Error())
+	}
+	if typ != certcrypto.EC256 {
+		t.Errorf(fmt.Sprintf("Expected EC256 but got %s", typ))
+	}
+
+	c = RawUserConfig{KeyType: "EC384"}
+	typ, err = c.getKeyType()
+	if err != nil {
+		t.Errorf(err.Error())
+	}
+	if typ != certcrypto.EC384 {
+		t.Errorf(fmt.Sprintf("Expected EC384 but got %s", typ))
+	}
+
 	c = RawUserConfig{KeyType: "unknown"}
 	typ, err = c.getKeyType()
 	got := err.Error()
-	want := "Invalid key type. Allowed values are 'RSA2048', 'RSA4096' and 'RSA8192'."
+	want := "Invalid key type. Allowed values are 'RSA2048', 'RSA4096', 'RSA8192', 'EC256' and 'EC384'."
 	if got != want {
 		t.Errorf(fmt.Sprintf("Bad error message. Want: %s. Got: %s", want, got))
 	}
 }
 
+// Test that several key types can be configured in hybrid mode
+func TestGetKeyTypes(t *testing.T) {
+	c := RawUserConfig{KeyType: "EC256, RSA2048"}
+	types, err := c.getKeyTypes()
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	want := []certcrypto.KeyType{certcrypto.EC256, certcrypto.RSA2048}
+	if !slices.Equal(types, want) {
+		t.Errorf("Bad key types. Want: %s. Got: %s", want, types)
+	}
+
+	c = RawUserConfig{KeyType: "EC256,EC256"}
+	_, err = c.getKeyTypes()
+	err_want := "Duplicate key type found in LE_CRT_KEY_TYPE environment variable: EC256"
+	if err == nil {
+		t.Fatalf("Expected error. Want: %s. Got: nil", err_want)
+	}
+	if err.Error() != err_want {
+		t.Errorf("Bad error. Want: %s. Got: %s", err_want, err.Error())
+	}
+}
+
 // Test that getCADir function behaves as expected
 func TestGetCADir(t *testing.T) {
 	want := constants.ACME_STAGING_CA_DIR
@@ -128,11 +178,270 @@ func TestGetCADir(t *testing.T) {
 
 }
 
+// Test that getChallenge function behaves as expected
+func TestGetChallenge(t *testing.T) {
+	c := &RawUserConfig{Challenge: "HTTP-01"}
+	got, err := c.getChallenge()
+	if err != nil {
+		t.Errorf(err.Error())
+	}
+	if got != constants.ACME_CHALLENGE_HTTP01 {
+		t.Errorf("Bad challenge. Want: %s. Got: %s", constants.ACME_CHALLENGE_HTTP01, got)
+	}
+
+	c = &RawUserConfig{Challenge: "unknown"}
+	_, err = c.getChallenge()
+	err_want := "Invalid ACME challenge. Allowed values are 'dns-01', 'http-01' and 'tls-alpn-01'."
+	if err == nil {
+		t.Fatalf("Expected error. Want: %s. Got: nil", err_want)
+	}
+	if err.Error() != err_want {
+		t.Errorf("Bad error. Want: %s. Got: %s", err_want, err.Error())
+	}
+}
+
+// Test that DNS credentials are not required when using HTTP-01 challenge
+func TestNewUserConfigWithHTTPChallenge(t *testing.T) {
+	stores := stores.TestStores("")
+	t.Setenv("DOMAINS", "example.com")
+	t.Setenv("ACCOUNT_EMAIL", "support@example.com")
+	t.Setenv("ACCOUNT_KEY_FILE", filepath.Join(t.TempDir(), "account.key"))
+	t.Setenv("OUTPUT_DIRECTORY", t.TempDir())
+	t.Setenv(constants.ACME_CHALLENGE, "http-01")
+	t.Setenv(constants.HTTP_CHALLENGE_ADDRESS, "127.0.0.1:8080")
+	config, err := NewUserConfig(&stores)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if config.HTTPAddress != "127.0.0.1:8080" {
+		t.Fatalf("Bad HTTP address. Want: 127.0.0.1:8080. Got: %s", config.HTTPAddress)
+	}
+
+	t.Setenv(constants.HTTP_CHALLENGE_ADDRESS, "8080")
+	_, err = NewUserConfig(&stores)
+	err_want := "Invalid address found in HTTP_CHALLENGE_ADDRESS environment variable: 8080"
+	if err == nil {
+		t.Fatalf("Expected error. Want: %s. Got: nil", err_want)
+	}
+	if err.Error() != err_want {
+		t.Fatalf("Bad error. Want: %s. Got: %s", err_want, err.Error())
+	}
+}
+
+// Test that output configuration is parsed without secrets nor side effects
+func TestNewOutputConfig(t *testing.T) {
+	outputDirectory := filepath.Join(t.TempDir(), "certs")
+	t.Setenv("DOMAINS", "*.example.com")
+	t.Setenv("OUTPUT_DIRECTORY", outputDirectory)
+	t.Setenv(constants.LE_CRT_KEY_TYPE, "EC256,RSA2048")
+	config, err := NewOutputConfig()
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if config.Filename != "_.example.com" {
+		t.Fatalf("Bad filename. Want: _.example.com. Got: %s", config.Filename)
+	}
+	if config.OutputDirectory != outputDirectory {
+		t.Fatalf("Bad output directory. Want: %s. Got: %s", outputDirectory, config.OutputDirectory)
+	}
+	if config.CADirKeyType != certcrypto.EC256 || len(config.AdditionalKeyTypes) != 1 {
+		t.Fatalf("Bad key types. Want: EC256,RSA2048. Got: %s,%v", config.CADirKeyType, config.AdditionalKeyTypes)
+	}
+	if _, err := os.Stat(outputDirectory); err == nil {
+		t.Fatalf("Output directory should not be created")
+	}
+}
+
+// Test that output configuration only requires domains when filename is not set
+func TestNewOutputConfigWithoutDomains(t *testing.T) {
+	t.Setenv("DOMAINS", "")
+	t.Setenv("FILENAME", "")
+	_, err := NewOutputConfig()
+	err_want := "A file name must be provided through FILENAME environment variable when DOMAINS is not set"
+	if err == nil || err.Error() != err_want {
+		t.Fatalf("Bad error. Want: %s. Got: %v", err_want, err)
+	}
+	t.Setenv("FILENAME", "nats")
+	config, err := NewOutputConfig()
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if config.Filename != "nats" {
+		t.Fatalf("Bad filename. Want: nats. Got: %s", config.Filename)
+	}
+}
+
+// Test that TLS challenge address is validated when using TLS-ALPN-01 challenge
+func TestNewUserConfigWithTLSChallenge(t *testing.T) {
+	stores := stores.TestStores("")
+	t.Setenv("DOMAINS", "example.com")
+	t.Setenv("ACCOUNT_EMAIL", "support@example.com")
+	t.Setenv("ACCOUNT_KEY_FILE", filepath.Join(t.TempDir(), "account.key"))
+	t.Setenv("OUTPUT_DIRECTORY", t.TempDir())
+	t.Setenv(constants.ACME_CHALLENGE, "tls-alpn-01")
+	config, err := NewUserConfig(&stores)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if config.TLSAddress != constants.DEFAULT_TLS_CHALLENGE_ADDRESS {
+		t.Fatalf("Bad TLS address. Want: %s. Got: %s", constants.DEFAULT_TLS_CHALLENGE_ADDRESS, config.TLSAddress)
+	}
+
+	t.Setenv(constants.TLS_CHALLENGE_ADDRESS, "localhost:https")
+	_, err = NewUserConfig(&stores)
+	err_want := "Invalid port found in TLS_CHALLENGE_ADDRESS environment variable: localhost:https"
+	if err == nil {
+		t.Fatalf("Expected error. Want: %s. Got: nil", err_want)
+	}
+	if err.Error() != err_want {
+		t.Fatalf("Bad error. Want: %s. Got: %s", err_want, err.Error())
+	}
+}
+
+// Test that retry policy options are validated
+func TestGetRetryPolicy(t *testing.T) {
+	c := &RawUserConfig{RetryInitial: "30", RetryMax: "3600", RetryMultiplier: "1.5", RetryJitter: "0.1"}
+	initial, max, err := c.getRetryIntervals()
+	if err != nil {
+		t.Errorf(err.Error())
+	}
+	if initial != 30*time.Second || max != time.Hour {
+		t.Errorf("Bad retry intervals. Want: 30s and 1h. Got: %s and %s", initial, max)
+	}
+	multiplier, err := c.getRetryMultiplier()
+	if err != nil || multiplier != 1.5 {
+		t.Errorf("Bad retry multiplier. Want: 1.5. Got: %f", multiplier)
+	}
+	jitter, err := c.getRetryJitter()
+	if err != nil || jitter != 0.1 {
+		t.Errorf("Bad retry jitter. Want: 0.1. Got: %f", jitter)
+	}
+
+	c = &RawUserConfig{RetryInitial: "60", RetryMax: "30"}
+	_, _, err = c.getRetryIntervals()
+	err_want := "Invalid retry interval found in RETRY_MAX_INTERVAL environment variable: 30. It must be greater than RETRY_INITIAL_INTERVAL."
+	if err == nil {
+		t.Fatalf("Expected error. Want: %s. Got: nil", err_want)
+	}
+	if err.Error() != err_want {
+		t.Errorf("Bad error. Want: %s. Got: %s", err_want, err.Error())
+	}
+
+	c = &RawUserConfig{RetryJitter: "2"}
+	_, err = c.getRetryJitter()
+	err_want = "Invalid retry jitter found in RETRY_JITTER environment variable: 2. It must be between 0 and 1."
+	if err == nil {
+		t.Fatalf("Expected error. Want: %s. Got: nil", err_want)
+	}
+	if err.Error() != err_want {
+		t.Errorf("Bad error. Want: %s. Got: %s", err_want, err.Error())
+	}
+}
+
+func TestGetAdminService(t *testing.T) {
+	storage := stores.TestStores("")
+	c := &RawUserConfig{AdminSubject: "letsgo.admin"}
+	subject, user, _, err := c.getAdminService(&storage)
+	if err != nil {
+		t.Errorf(err.Error())
+	}
+	if subject != "" || user != "" {
+		t.Errorf("Bad admin service. Want: disabled. Got: %s for user %s", subject, user)
+	}
+
+	c = &RawUserConfig{AdminSubject: "ops.letsgo", AdminUser: "admin", AdminPassword: RawSecret{Value: "s3cr3t"}}
+	subject, user, password, err := c.getAdminService(&storage)
+	if err != nil {
+		t.Errorf(err.Error())
+	}
+	if subject != "ops.letsgo" || user != "admin" || password != "s3cr3t" {
+		t.Errorf("Bad admin service. Want: ops.letsgo for user admin. Got: %s for user %s", subject, user)
+	}
+
+	c = &RawUserConfig{AdminSubject: "letsgo.>", AdminUser: "admin", AdminPassword: RawSecret{Value: "s3cr3t"}}
+	_, _, _, err = c.getAdminService(&storage)
+	err_want := "Invalid subject found in ADMIN_SUBJECT environment variable: letsgo.>. It must be a NATS subject without wildcards."
+	if err == nil {
+		t.Fatalf("Expected error. Want: %s. Got: nil", err_want)
+	}
+	if err.Error() != err_want {
+		t.Errorf("Bad error. Want: %s. Got: %s", err_want, err.Error())
+	}
+
+	c = &RawUserConfig{AdminSubject: "letsgo.admin", AdminUser: "admin"}
+	_, _, _, err = c.getAdminService(&storage)
+	err_want = "Invalid admin password. Use one of 'ADMIN_PASSWORD_VAULT', 'ADMIN_PASSWORD_FILE' or 'ADMIN_PASSWORD' env variable"
+	if err == nil {
+		t.Fatalf("Expected error. Want: %s. Got: nil", err_want)
+	}
+	if err.Error() != err_want {
+		t.Errorf("Bad error. Want: %s. Got: %s", err_want, err.Error())
+	}
+}
+
+func TestGetEventsPublisher(t *testing.T) {
+	storage := stores.TestStores("")
+	c := &RawUserConfig{}
+	subject, _, _, err := c.getEventsPublisher(&storage)
+	if err != nil {
+		t.Errorf(err.Error())
+	}
+	if subject != "" {
+		t.Errorf("Bad events subject. Want: disabled. Got: %s", subject)
+	}
+
+	c = &RawUserConfig{EventsSubject: "letsgo.events"}
+	subject, user, _, err := c.getEventsPublisher(&storage)
+	if err != nil {
+		t.Errorf(err.Error())
+	}
+	if subject != "letsgo.events" || user != "" {
+		t.Errorf("Bad events publisher. Want: letsgo.events without user. Got: %s for user %s", subject, user)
+	}
+
+	c = &RawUserConfig{EventsSubject: "letsgo.*"}
+	_, _, _, err = c.getEventsPublisher(&storage)
+	err_want := "Invalid subject found in EVENTS_SUBJECT environment variable: letsgo.*. It must be a NATS subject without wildcards."
+	if err == nil {
+		t.Fatalf("Expected error. Want: %s. Got: nil", err_want)
+	}
+	if err.Error() != err_want {
+		t.Errorf("Bad error. Want: %s. Got: %s", err_want, err.Error())
+	}
+}
+
+func TestGetListenerAddresses(t *testing.T) {
+	c := &RawUserConfig{}
+	address, err := c.getMetricsAddress()
+	if err != nil || address != "" {
+		t.Errorf("Bad metrics address. Want: disabled. Got: %s", address)
+	}
+	c = &RawUserConfig{MetricsAddress: ":9180"}
+	address, err = c.getMetricsAddress()
+	if err != nil || address != ":9180" {
+		t.Errorf("Bad metrics address. Want: :9180. Got: %s", address)
+	}
+	c = &RawUserConfig{HealthAddress: "0.0.0.0:8080"}
+	address, err = c.getHealthAddress()
+	if err != nil || address != "0.0.0.0:8080" {
+		t.Errorf("Bad health address. Want: 0.0.0.0:8080. Got: %s", address)
+	}
+	c = &RawUserConfig{MetricsAddress: "9180"}
+	_, err = c.getMetricsAddress()
+	err_want := "Invalid address found in METRICS_ADDRESS environment variable: 9180"
+	if err == nil {
+		t.Fatalf("Expected error. Want: %s. Got: nil", err_want)
+	}
+	if err.Error() != err_want {
+		t.Errorf("Bad error. Want: %s. Got: %s", err_want, err.Error())
+	}
+}
+
 // Test that getAuthToken behaves as expected
 func TestGetAuthTokenFail(t *testing.T) {
 	c := NewRawUserConfig()
 	storage := stores.TestStores("")
-	token, err := c.getDNSAuthToken(&storage)
+	token, err := c.getDNSCredential(&storage, testDNSCredential)
 	if token != "" || err == nil {
 		t.Errorf(fmt.Sprintf("Expected empty token and error, got token: %s", token))
 	}
@@ -148,7 +457,7 @@ func TestGetAuthTokenFromValue(t *testing.T) {
 	t.Setenv("DNS_AUTH_TOKEN", want)
 	c := NewRawUserConfig()
 	storage := stores.TestStores("")
-	token, err := c.getDNSAuthToken(&storage)
+	token, err := c.getDNSCredential(&storage, testDNSCredential)
 	if err != nil {
 		t.Errorf(err.Error())
 	}
@@ -166,7 +475,7 @@ func TestGetAuthTokenFromFile(t *testing.T) {
 	t.Setenv("DNS_AUTH_TOKEN_FILE", tokenFile)
 	c := NewRawUserConfig()
 	storage := stores.TestStores(want)
-	token, err := c.getDNSAuthToken(&storage)
+	token, err := c.getDNSCredential(&storage, testDNSCredential)
 	if err != nil {
 		t.Errorf(err.Error())
 	}
@@ -180,7 +489,7 @@ func TestGetAuthTokenFromKeyVault(t *testing.T) {
 	t.Setenv("DNS_AUTH_TOKEN_VAULT", "test-vault")
 	c := NewRawUserConfig()
 	storage := stores.TestStores(want)
-	token, err := c.getDNSAuthToken(&storage)
+	token, err := c.getDNSCredential(&storage, testDNSCredential)
 	if err != nil {
 		t.Errorf(err.Error())
 	}
@@ -230,9 +539,12 @@ func TestNewUserConfigFromEnv(t *testing.T) {
 	if !slices.Equal(config.Domains, want_domains) {
 		t.Fatalf("Bad domain. Want: %s. Got: %s", config.Domains, want_domains)
 	}
-	if config.AuthToken != want_token {
+	if config.DNSProvider != constants.DNS_PROVIDER_DIGITALOCEAN {
+		t.Fatalf("Bad DNS provider. Want: %s. Got: %s", constants.DNS_PROVIDER_DIGITALOCEAN, config.DNSProvider)
+	}
+	if config.DNSCredentials["AUTH_TOKEN"] != want_token {
 		t.Fatalf(
-			"Bad token. Want: %s. Got: %s", want_token, config.AuthToken,
+			"Bad token. Want: %s. Got: %s", want_token, config.DNSCredentials["AUTH_TOKEN"],
 		)
 	}
 
@@ -262,6 +574,69 @@ func TestNewUserConfigFromEnv(t *testing.T) {
 		t.Fatalf("Bad DisableCP option. Want: true. Got: false")
 	}
 
+	t.Setenv(constants.REUSE_PRIVATE_KEY, "true")
+	config, err = NewUserConfig(&stores)
+	if !config.ReusePrivateKey {
+		t.Fatalf("Bad ReusePrivateKey option. Want: true. Got: false")
+	}
+
+	if config.OutputRetention != 5 {
+		t.Fatalf("Bad OutputRetention option. Want: 5. Got: %d", config.OutputRetention)
+	}
+	t.Setenv(constants.OUTPUT_RETENTION, "0")
+	err_want = "Invalid number of versions found in OUTPUT_RETENTION environment variable: 0. It must be a positive integer."
+	_, err = NewUserConfig(&stores)
+	if err == nil {
+		t.Fatalf("Expected error. Want: %s. Got: nil", err_want)
+	}
+	err_got = err.Error()
+	if err_got != err_want {
+		t.Fatalf("Bad error. Want: %s. Got: %s", err_want, err_got)
+	}
+	t.Setenv(constants.OUTPUT_RETENTION, constants.DEFAULT_OUTPUT_RETENTION)
+
+	t.Setenv(constants.TLS_LISTENERS, "Client, websocket,client")
+	config, err = NewUserConfig(&stores)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if !slices.Equal(config.TLSListeners, []string{"client", "websocket"}) {
+		t.Fatalf("Bad TLSListeners option. Want: [client websocket]. Got: %v", config.TLSListeners)
+	}
+	t.Setenv(constants.TLS_LISTENERS, "https")
+	err_want = "HTTPS monitoring uses client TLS configuration. 'client' must also be listed in TLS_LISTENERS environment variable."
+	_, err = NewUserConfig(&stores)
+	if err == nil {
+		t.Fatalf("Expected error. Want: %s. Got: nil", err_want)
+	}
+	err_got = err.Error()
+	if err_got != err_want {
+		t.Fatalf("Bad error. Want: %s. Got: %s", err_want, err_got)
+	}
+	t.Setenv(constants.TLS_LISTENERS, "cluster")
+	err_want = "Invalid listener found in TLS_LISTENERS environment variable: cluster. Allowed values are 'client', 'websocket', 'mqtt', 'leafnode', 'gateway', 'https'."
+	_, err = NewUserConfig(&stores)
+	if err == nil {
+		t.Fatalf("Expected error. Want: %s. Got: nil", err_want)
+	}
+	err_got = err.Error()
+	if err_got != err_want {
+		t.Fatalf("Bad error. Want: %s. Got: %s", err_want, err_got)
+	}
+	t.Setenv(constants.TLS_LISTENERS, "")
+
+	t.Setenv(constants.DNS_PROVIDER, "unknown")
+	err_want = "Invalid DNS provider: unknown. Available providers are: digitalocean"
+	_, err = NewUserConfig(&stores)
+	if err == nil {
+		t.Fatalf("Expected error. Want: %s. Got: nil", err_want)
+	}
+	err_got = err.Error()
+	if err_got != err_want {
+		t.Fatalf("Bad error. Want: %s. Got: %s", err_want, err_got)
+	}
+	t.Setenv(constants.DNS_PROVIDER, constants.DNS_PROVIDER_DIGITALOCEAN)
+
 	t.Setenv(constants.LE_TOS_AGREED, "false")
 	err_want = "It is mandatory to agree to Let's Encrypt Term of Usage through LE_TOS_AGREED environment variable"
 	_, err = NewUserConfig(&stores)
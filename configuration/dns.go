@@ -0,0 +1,91 @@
+package configuration
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/quara-dev/letsgo-nats/constants"
+	"github.com/quara-dev/letsgo-nats/stores"
+)
+
+// A credential required by a DNS provider
+//
+// Credential value is resolved from one of the following environment variables:
+//   - DNS_<NAME>: credential value
+//   - DNS_<NAME>_FILE: path to file holding credential value
+//   - DNS_<NAME>_VAULT: name or URI of Azure Keyvault holding credential value
+//
+// When using Azure Keyvault, the name of the secret is read from DNS_<NAME>_SECRET
+// and defaults to DefaultSecret.
+type DNSCredential struct {
+	Name          string
+	DefaultSecret string
+	Optional      bool
+}
+
+// Credentials declared by DNS providers, indexed by provider name
+var dnsCredentials = map[string][]DNSCredential{}
+
+// Register the credentials required by a DNS provider.
+//
+// This function is called by the acme package when a DNS provider is registered.
+func RegisterDNSCredentials(provider string, credentials ...DNSCredential) {
+	dnsCredentials[provider] = credentials
+}
+
+// Name of environment variable holding credential value
+func (d DNSCredential) env() string {
+	return constants.DNS_CREDENTIAL_PREFIX + d.Name
+}
+
+// Read raw credentials of a DNS provider from environment
+func getRawDNSCredentials(provider string) map[string]RawSecret {
+	credentials := map[string]RawSecret{}
+	for _, credential := range dnsCredentials[provider] {
+		credentials[credential.Name] = getRawSecret(credential.env(), credential.DefaultSecret)
+	}
+	return credentials
+}
+
+// Names of registered DNS providers
+func dnsProviderNames() []string {
+	names := []string{}
+	for name := range dnsCredentials {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (c *RawUserConfig) getDNSProvider() (string, error) {
+	provider := strings.ToLower(c.DNSProvider)
+	if _, ok := dnsCredentials[provider]; !ok {
+		return "", errors.New(fmt.Sprintf("Invalid DNS provider: %s. Available providers are: %s", c.DNSProvider, strings.Join(dnsProviderNames(), ", ")))
+	}
+	return provider, nil
+}
+
+func (c *RawUserConfig) getDNSCredential(storage *stores.Stores, credential DNSCredential) (string, error) {
+	raw := c.DNSCredentials[credential.Name]
+	name := strings.ToLower(strings.ReplaceAll(credential.Name, "_", " "))
+	return raw.resolve(storage, credential.env(), "DNS "+name)
+}
+
+func (c *RawUserConfig) getDNSCredentials(storage *stores.Stores, provider string) (map[string]string, error) {
+	credentials := map[string]string{}
+	for _, credential := range dnsCredentials[provider] {
+		raw := c.DNSCredentials[credential.Name]
+		// Skip optional credentials which are not configured
+		if credential.Optional && raw.isEmpty() {
+			continue
+		}
+		value, err := c.getDNSCredential(storage, credential)
+		if err != nil {
+			return credentials, err
+		}
+		credentials[credential.Name] = value
+	}
+	return credentials, nil
+}
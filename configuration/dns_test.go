@@ -0,0 +1,42 @@
+package configuration
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/quara-dev/letsgo-nats/stores"
+)
+
+// Test that optional DNS credentials can be omitted
+func TestGetDNSCredentialsOptional(t *testing.T) {
+	RegisterDNSCredentials("test-provider",
+		DNSCredential{Name: "TEST_REQUIRED"},
+		DNSCredential{Name: "TEST_OPTIONAL", Optional: true},
+	)
+	defer delete(dnsCredentials, "test-provider")
+
+	t.Setenv("DNS_TEST_REQUIRED", "XXXXX")
+	c := &RawUserConfig{DNSCredentials: getRawDNSCredentials("test-provider")}
+	storage := stores.TestStores("")
+	credentials, err := c.getDNSCredentials(&storage, "test-provider")
+	if err != nil {
+		t.Errorf(err.Error())
+	}
+	if credentials["TEST_REQUIRED"] != "XXXXX" {
+		t.Errorf(fmt.Sprintf("Bad credential. Want: XXXXX. Got: %s", credentials["TEST_REQUIRED"]))
+	}
+	if _, ok := credentials["TEST_OPTIONAL"]; ok {
+		t.Errorf("Optional credential should not be set")
+	}
+
+	t.Setenv("DNS_TEST_REQUIRED", "")
+	c = &RawUserConfig{DNSCredentials: getRawDNSCredentials("test-provider")}
+	_, err = c.getDNSCredentials(&storage, "test-provider")
+	if err == nil {
+		t.Fatalf("Expected error but got nil")
+	}
+	err_want := "Invalid DNS test required. Use one of 'DNS_TEST_REQUIRED_VAULT', 'DNS_TEST_REQUIRED_FILE' or 'DNS_TEST_REQUIRED' env variable"
+	if err.Error() != err_want {
+		t.Errorf("Bad error. Want: %s. Got: %s", err_want, err.Error())
+	}
+}
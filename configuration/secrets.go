@@ -0,0 +1,81 @@
+package configuration
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/quara-dev/letsgo-nats/constants"
+	"github.com/quara-dev/letsgo-nats/stores"
+)
+
+// Raw secret values as found in environment
+//
+// A secret named <NAME> is resolved from one of the following environment variables:
+//   - <NAME>: secret value
+//   - <NAME>_FILE: path to file holding secret value
+//   - <NAME>_VAULT: name or URI of Azure Keyvault holding secret value
+//
+// When using Azure Keyvault, the name of the secret is read from <NAME>_SECRET.
+type RawSecret struct {
+	Value  string
+	File   string
+	Vault  string
+	Secret string
+}
+
+// Read raw secret values from environment
+func getRawSecret(env string, defaultSecret string) RawSecret {
+	return RawSecret{
+		Value:  getEnv(env, ""),
+		File:   getEnv(env+constants.SECRET_FILE_SUFFIX, ""),
+		Vault:  getEnv(env+constants.SECRET_VAULT_SUFFIX, ""),
+		Secret: getEnv(env+constants.SECRET_NAME_SUFFIX, defaultSecret),
+	}
+}
+
+// Check if secret is not configured at all
+func (s RawSecret) isEmpty() bool {
+	return s.Value == "" && s.File == "" && s.Vault == ""
+}
+
+// Resolve secret value using stores.
+//
+// Name of environment variable and description are used in error messages.
+func (s RawSecret) resolve(storage *stores.Stores, env string, description string) (string, error) {
+	// Check that value is not empty
+	if s.Value != "" {
+		return s.Value, nil
+	}
+	// Check if value should be fetched from file
+	if s.File != "" {
+		filestore := storage.GetFileStore()
+		return filestore.GetToken(s.File)
+	}
+	// Check if value should be fetched from vault
+	if s.Vault != "" {
+		uri, err := getVaultURI(s.Vault)
+		if err != nil {
+			return "", err
+		}
+		if s.Secret == "" {
+			return "", errors.New(fmt.Sprintf("Invalid secret name found in %s environment variable", env+constants.SECRET_NAME_SUFFIX))
+		}
+		keyvault := storage.GetKeyvaultStore()
+		return keyvault.GetToken(uri, s.Secret)
+	}
+	// Return an error
+	return "", errors.New(fmt.Sprintf("Invalid %s. Use one of '%s', '%s' or '%s' env variable", description, env+constants.SECRET_VAULT_SUFFIX, env+constants.SECRET_FILE_SUFFIX, env))
+}
+
+// Get URI of an Azure Keyvault from either its name or its URI
+func getVaultURI(vault string) (string, error) {
+	if vault == "" {
+		return "", errors.New(fmt.Sprintf("Invalid Keyvault URI: %s", vault))
+	}
+	if strings.HasPrefix(vault, "https://") {
+		return vault, nil
+	} else {
+		return fmt.Sprintf("https://%s.vault.azure.net/", vault), nil
+	}
+}
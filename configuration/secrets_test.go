@@ -0,0 +1,58 @@
+package configuration
+
+import (
+	"testing"
+
+	"github.com/quara-dev/letsgo-nats/stores"
+)
+
+// Test that getVaultURI accepts both names and URIs
+func TestGetVaultURI(t *testing.T) {
+	got, err := getVaultURI("test-vault")
+	if err != nil {
+		t.Errorf(err.Error())
+	}
+	want := "https://test-vault.vault.azure.net/"
+	if got != want {
+		t.Errorf("got %q, wanted %q", got, want)
+	}
+	want = "https://somewhere/"
+	got, err = getVaultURI(want)
+	if err != nil {
+		t.Errorf(err.Error())
+	}
+	if got != want {
+		t.Errorf("got %q, wanted %q", got, want)
+	}
+}
+
+// Test that External Account Binding is optional but requires both values
+func TestGetExternalAccountBinding(t *testing.T) {
+	storage := stores.TestStores("XXXXX")
+	c := NewRawUserConfig()
+	kid, hmac, err := c.getExternalAccountBinding(&storage)
+	if err != nil || kid != "" || hmac != "" {
+		t.Errorf("External Account Binding should be empty when not configured")
+	}
+
+	t.Setenv("EAB_KID", "kid")
+	c = NewRawUserConfig()
+	_, _, err = c.getExternalAccountBinding(&storage)
+	err_want := "Invalid EAB HMAC key. Use one of 'EAB_HMAC_VAULT', 'EAB_HMAC_FILE' or 'EAB_HMAC' env variable"
+	if err == nil {
+		t.Fatalf("Expected error. Want: %s. Got: nil", err_want)
+	}
+	if err.Error() != err_want {
+		t.Errorf("Bad error. Want: %s. Got: %s", err_want, err.Error())
+	}
+
+	t.Setenv("EAB_HMAC_VAULT", "test-vault")
+	c = NewRawUserConfig()
+	kid, hmac, err = c.getExternalAccountBinding(&storage)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if kid != "kid" || hmac != "XXXXX" {
+		t.Errorf("Bad External Account Binding. Want: kid and XXXXX. Got: %s and %s", kid, hmac)
+	}
+}
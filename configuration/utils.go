@@ -2,7 +2,10 @@ package configuration
 
 import (
 	"errors"
+	"fmt"
+	"net"
 	"os"
+	"strconv"
 	"strings"
 
 	"golang.org/x/net/idna"
@@ -41,3 +44,18 @@ func fileExists(path string) bool {
 	}
 	return true
 }
+
+// Validate an address to listen on.
+//
+// Address must be in `host:port` format, host being optional.
+// Name of environment variable is used in error message.
+func getListenAddress(address string, name string) (string, error) {
+	_, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return "", errors.New(fmt.Sprintf("Invalid address found in %s environment variable: %s", name, address))
+	}
+	if _, err := strconv.ParseUint(port, 10, 16); err != nil {
+		return "", errors.New(fmt.Sprintf("Invalid port found in %s environment variable: %s", name, address))
+	}
+	return address, nil
+}
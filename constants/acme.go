@@ -5,7 +5,15 @@ package constants
 const ACME_PRODUCTION_ENV = "PRODUCTION"
 const ACME_STAGING_ENV = "STAGING"
 const ACME_TEST_ENV = "TEST"
+const ACME_ZEROSSL_ENV = "ZEROSSL"
+const ACME_GOOGLE_ENV = "GOOGLE"
 
 const ACME_PRODUCTION_CA_DIR = "https://acme-v02.api.letsencrypt.org/directory"
 const ACME_STAGING_CA_DIR = "https://acme-staging-v02.api.letsencrypt.org/directory"
 const ACME_TEST_CA_DIR = "http://localhost:4000/directory"
+const ACME_ZEROSSL_CA_DIR = "https://acme.zerossl.com/v2/DV90"
+const ACME_GOOGLE_CA_DIR = "https://dv.acme-v02.api.pki.goog/directory"
+
+const ACME_CHALLENGE_DNS01 = "dns-01"
+const ACME_CHALLENGE_HTTP01 = "http-01"
+const ACME_CHALLENGE_TLSALPN01 = "tls-alpn-01"
@@ -8,3 +8,15 @@ const DEFAULT_DISABLE_CP = "true"
 const DEFAULT_LE_CRT_KEY_TYPE = KEY_TYPE_RSA2048
 const DEFAULT_CA_DIR = ACME_STAGING_ENV
 const DEFAULT_DNS_AUTH_TOKEN_SECRET = "do-auth-token"
+const DEFAULT_DNS_PROVIDER = DNS_PROVIDER_DIGITALOCEAN
+const DEFAULT_ACME_CHALLENGE = ACME_CHALLENGE_DNS01
+const DEFAULT_HTTP_CHALLENGE_ADDRESS = ":80"
+const DEFAULT_TLS_CHALLENGE_ADDRESS = ":443"
+const DEFAULT_RETRY_INITIAL_INTERVAL = "60"
+const DEFAULT_RETRY_MAX_INTERVAL = "21600"
+const DEFAULT_RETRY_MULTIPLIER = "2"
+const DEFAULT_RETRY_JITTER = "0.2"
+const DEFAULT_RENEW_REMAINING_PERCENT = "33"
+const DEFAULT_REUSE_PRIVATE_KEY = "false"
+const DEFAULT_OUTPUT_RETENTION = "5"
+const DEFAULT_ADMIN_SUBJECT = "letsgo.admin"
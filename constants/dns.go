@@ -0,0 +1,7 @@
+package constants
+
+// This module contains DNS provider names
+
+const DNS_PROVIDER_DIGITALOCEAN = "digitalocean"
+const DNS_PROVIDER_CLOUDFLARE = "cloudflare"
+const DNS_PROVIDER_RFC2136 = "rfc2136"
@@ -2,10 +2,10 @@ package constants
 
 // This module contains environment variable names
 
-const DNS_AUTH_TOKEN = "DNS_AUTH_TOKEN"
-const DNS_AUTH_TOKEN_FILE = "DNS_AUTH_TOKEN_FILE"
-const DNS_AUTH_TOKEN_VAULT = "DNS_AUTH_TOKEN_VAULT"
-const DNS_AUTH_TOKEN_SECRET = "DNS_AUTH_TOKEN_SECRET"
+const ACME_CHALLENGE = "ACME_CHALLENGE"
+const HTTP_CHALLENGE_ADDRESS = "HTTP_CHALLENGE_ADDRESS"
+const TLS_CHALLENGE_ADDRESS = "TLS_CHALLENGE_ADDRESS"
+const DNS_PROVIDER = "DNS_PROVIDER"
 const DNS_RESOLVERS = "DNS_RESOLVERS"
 const DNS_TIMEOUT = "DNS_TIMEOUT"
 const DISABLE_CP = "DISABLE_CP"
@@ -17,3 +17,44 @@ const LE_TOS_AGREED = "LE_TOS_AGREED"
 const CA_DIR = "CA_DIR"
 const LE_CRT_KEY_TYPE = "LE_CRT_KEY_TYPE"
 const OUTPUT_DIRECTORY = "OUTPUT_DIRECTORY"
+const OUTPUT_RETENTION = "OUTPUT_RETENTION"
+const TLS_LISTENERS = "TLS_LISTENERS"
+const RENEW_REMAINING_PERCENT = "RENEW_REMAINING_PERCENT"
+const REUSE_PRIVATE_KEY = "REUSE_PRIVATE_KEY"
+const PREFERRED_CHAIN = "PREFERRED_CHAIN"
+
+// DNS provider credentials are read from environment variables
+// named after the credential, e.g. DNS_AUTH_TOKEN
+const DNS_CREDENTIAL_PREFIX = "DNS_"
+
+// Secrets can also be read from file or Azure Keyvault, e.g. using
+// DNS_AUTH_TOKEN_FILE, or DNS_AUTH_TOKEN_VAULT and DNS_AUTH_TOKEN_SECRET
+const SECRET_FILE_SUFFIX = "_FILE"
+const SECRET_VAULT_SUFFIX = "_VAULT"
+const SECRET_NAME_SUFFIX = "_SECRET"
+
+// External Account Binding
+const EAB_KID = "EAB_KID"
+const EAB_HMAC = "EAB_HMAC"
+
+// Renewal retry policy
+const RETRY_INITIAL_INTERVAL = "RETRY_INITIAL_INTERVAL"
+const RETRY_MAX_INTERVAL = "RETRY_MAX_INTERVAL"
+const RETRY_MULTIPLIER = "RETRY_MULTIPLIER"
+const RETRY_JITTER = "RETRY_JITTER"
+
+// Admin service, exposed on NATS system account
+const ADMIN_SUBJECT = "ADMIN_SUBJECT"
+const ADMIN_USER = "ADMIN_USER"
+const ADMIN_PASSWORD = "ADMIN_PASSWORD"
+
+// Certificate lifecycle events, published on NATS
+const EVENTS_SUBJECT = "EVENTS_SUBJECT"
+const EVENTS_USER = "EVENTS_USER"
+const EVENTS_PASSWORD = "EVENTS_PASSWORD"
+
+// Prometheus metrics listener
+const METRICS_ADDRESS = "METRICS_ADDRESS"
+
+// Health and readiness probes listener
+const HEALTH_ADDRESS = "HEALTH_ADDRESS"
@@ -0,0 +1,8 @@
+package constants
+
+// This module contains types of certificate lifecycle events
+
+const EVENT_ISSUED = "issued"
+const EVENT_RENEWED = "renewed"
+const EVENT_FAILED = "failed"
+const EVENT_EXPIRING = "expiring"
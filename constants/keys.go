@@ -5,3 +5,5 @@ package constants
 const KEY_TYPE_RSA2048 = "RSA2048"
 const KEY_TYPE_RSA4096 = "RSA4096"
 const KEY_TYPE_RSA8192 = "RSA8192"
+const KEY_TYPE_EC256 = "EC256"
+const KEY_TYPE_EC384 = "EC384"
@@ -0,0 +1,10 @@
+package constants
+
+// This module contains names of NATS listeners which can use managed certificates
+
+const TLS_LISTENER_CLIENT = "client"
+const TLS_LISTENER_WEBSOCKET = "websocket"
+const TLS_LISTENER_MQTT = "mqtt"
+const TLS_LISTENER_LEAFNODE = "leafnode"
+const TLS_LISTENER_GATEWAY = "gateway"
+const TLS_LISTENER_HTTPS = "https"
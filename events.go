@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"sync"
+
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+
+	"github.com/quara-dev/letsgo-nats/acme"
+	"github.com/quara-dev/letsgo-nats/configuration"
+)
+
+// Publish certificate lifecycle events on NATS.
+//
+// Events emitted before NATS server is started (e.g. when certificates are
+// requested on startup) are kept until publisher is connected.
+type eventPublisher struct {
+	subject string
+
+	mu      sync.Mutex
+	ns      *server.Server
+	nc      *nats.Conn
+	pending []acme.CertificateEvent
+}
+
+// Create an event publisher and register it for certificate lifecycle events
+func newEventPublisher(config *configuration.UserConfig) *eventPublisher {
+	p := &eventPublisher{subject: config.EventsSubject}
+	acme.OnCertificateEvent(p.publish)
+	return p
+}
+
+// Publish an event, or keep it until publisher is connected
+func (p *eventPublisher) publish(event acme.CertificateEvent) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.nc == nil {
+		p.pending = append(p.pending, event)
+		return
+	}
+	p.send(event)
+}
+
+// Send an event. Must be called with lock held.
+func (p *eventPublisher) send(event acme.CertificateEvent) {
+	data, err := json.Marshal(event)
+	if err != nil {
+		p.ns.Errorf("Failed to encode certificate event: %v", err)
+		return
+	}
+	if err := p.nc.Publish(p.subject, data); err != nil {
+		p.ns.Warnf("Failed to publish certificate %s event: %v", event.Type, err)
+	}
+}
+
+// Connect publisher to embedded NATS server, and publish pending events
+func (p *eventPublisher) connect(ns *server.Server, config *configuration.UserConfig) error {
+	options := []nats.Option{
+		nats.InProcessServer(ns),
+		nats.Name("letsgo-nats events"),
+	}
+	if config.EventsUser != "" {
+		options = append(options, nats.UserInfo(config.EventsUser, config.EventsPassword))
+	}
+	nc, err := nats.Connect("", options...)
+	if err != nil {
+		// Stop collecting events which cannot be published
+		acme.OnCertificateEvent(nil)
+		return err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.ns = ns
+	p.nc = nc
+	for _, event := range p.pending {
+		p.send(event)
+	}
+	p.pending = nil
+	ns.Noticef("Publishing certificate events on %s", p.subject)
+	return nil
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+
+	"github.com/quara-dev/letsgo-nats/acme"
+	"github.com/quara-dev/letsgo-nats/configuration"
+)
+
+// Maximum delay to wait for NATS server to accept connections when probed
+const READY_TIMEOUT = 100 * time.Millisecond
+
+// Reply to a probe
+type probeReply struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Health and readiness probes.
+//
+// NATS server is nil in sidecar mode, in which case readiness only checks certificates.
+type probes struct {
+	ns     *server.Server
+	config *configuration.UserConfig
+	holder *acme.CertificateHolder
+	task   *renewTask
+}
+
+// Write probe result as JSON, with status 503 when probe failed
+func writeProbe(w http.ResponseWriter, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	reply := probeReply{Status: "ok"}
+	if err != nil {
+		reply = probeReply{Status: "error", Error: err.Error()}
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(reply)
+}
+
+// Liveness reflects the state of the renewal task
+func (p *probes) healthz(w http.ResponseWriter, req *http.Request) {
+	writeProbe(w, p.task.alive())
+}
+
+// Readiness requires NATS server to accept connections with a valid certificate
+func (p *probes) readyz(w http.ResponseWriter, req *http.Request) {
+	if p.ns != nil && !p.ns.ReadyForConnections(READY_TIMEOUT) {
+		writeProbe(w, errors.New("NATS server is not ready for connections"))
+		return
+	}
+	// Check certificates served by NATS listeners
+	if p.holder != nil {
+		writeProbe(w, p.holder.Check())
+	} else {
+		writeProbe(w, acme.CheckCertificates(p.config))
+	}
+}
+
+// Register health and readiness probes
+func (p *probes) register(mux *http.ServeMux) {
+	mux.HandleFunc("/healthz", p.healthz)
+	mux.HandleFunc("/readyz", p.readyz)
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-acme/lego/v4/certcrypto"
+
+	"github.com/quara-dev/letsgo-nats/acme"
+	"github.com/quara-dev/letsgo-nats/configuration"
+)
+
+// Create a configuration with output directory in a temporary directory
+func newTestConfig(t *testing.T) *configuration.UserConfig {
+	return &configuration.UserConfig{
+		OutputDirectory: t.TempDir(),
+		Filename:        "example.com",
+		Domains:         []string{"example.com"},
+	}
+}
+
+// Write a self-signed certificate, its private key and itself as issuer where managed certificates are expected
+func writeTestCertificate(t *testing.T, config *configuration.UserConfig, notBefore time.Time, notAfter time.Time) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: config.Domains[0]},
+		DNSNames:     config.Domains,
+		NotBefore:    notBefore,
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	certFile, keyFile := acme.CertificatePaths(config)
+	certPEM := certcrypto.PEMEncode(certcrypto.DERCertificateBytes(der))
+	if err := os.WriteFile(certFile, certPEM, 0o600); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if err := os.WriteFile(filepath.Join(config.OutputDirectory, config.Filename+".issuer.crt"), certPEM, 0o600); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if err := os.WriteFile(keyFile, certcrypto.PEMEncode(key), 0o600); err != nil {
+		t.Fatalf(err.Error())
+	}
+}
+
+// Send a request to a probe and decode its reply
+func probe(t *testing.T, p *probes, path string) (int, probeReply) {
+	mux := http.NewServeMux()
+	p.register(mux)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+	reply := probeReply{}
+	if err := json.Unmarshal(w.Body.Bytes(), &reply); err != nil {
+		t.Fatalf(err.Error())
+	}
+	return w.Code, reply
+}
+
+// Test that readiness fails when certificate served by holder is expired
+func TestReadyzExpiredCertificate(t *testing.T) {
+	config := newTestConfig(t)
+	writeTestCertificate(t, config, time.Now().Add(-48*time.Hour), time.Now().Add(-24*time.Hour))
+	holder, err := acme.NewCertificateHolder(config)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	code, reply := probe(t, &probes{config: config, holder: holder}, "/readyz")
+	if code != http.StatusServiceUnavailable || reply.Status != "error" {
+		t.Fatalf("Bad reply. Want: 503 error. Got: %d %s", code, reply.Status)
+	}
+	if !strings.Contains(reply.Error, "is not valid") {
+		t.Errorf("Bad error: %s", reply.Error)
+	}
+	// Holder serves renewed certificate once reloaded
+	writeTestCertificate(t, config, time.Now().Add(-time.Hour), time.Now().Add(24*time.Hour))
+	if err := holder.Reload(); err != nil {
+		t.Fatalf(err.Error())
+	}
+	code, reply = probe(t, &probes{config: config, holder: holder}, "/readyz")
+	if code != http.StatusOK || reply.Status != "ok" {
+		t.Errorf("Bad reply. Want: 200 ok. Got: %d %s %s", code, reply.Status, reply.Error)
+	}
+}
+
+// Test that readiness fails when certificate files are missing
+func TestReadyzMissingCertificate(t *testing.T) {
+	config := newTestConfig(t)
+	code, reply := probe(t, &probes{config: config}, "/readyz")
+	if code != http.StatusServiceUnavailable || reply.Status != "error" {
+		t.Fatalf("Bad reply. Want: 503 error. Got: %d %s", code, reply.Status)
+	}
+	if !strings.Contains(reply.Error, "example.com.crt") {
+		t.Errorf("Bad error: %s", reply.Error)
+	}
+}
+
+// Test that liveness fails when renewal task is not scheduled or stuck
+func TestHealthz(t *testing.T) {
+	task := &renewTask{}
+	p := &probes{config: newTestConfig(t), task: task}
+	code, reply := probe(t, p, "/healthz")
+	if code != http.StatusServiceUnavailable || reply.Error != "Certificate renewal task is not scheduled" {
+		t.Errorf("Bad reply. Want: 503 Certificate renewal task is not scheduled. Got: %d %s", code, reply.Error)
+	}
+	task.nextRun = time.Now().Add(-RENEW_STUCK_TIMEOUT - time.Minute)
+	code, reply = probe(t, p, "/healthz")
+	if code != http.StatusServiceUnavailable || !strings.HasPrefix(reply.Error, "Certificate renewal task is stuck since") {
+		t.Errorf("Bad reply. Want: 503 Certificate renewal task is stuck. Got: %d %s", code, reply.Error)
+	}
+	task.nextRun = time.Now().Add(time.Hour)
+	code, reply = probe(t, p, "/healthz")
+	if code != http.StatusOK || reply.Status != "ok" {
+		t.Errorf("Bad reply. Want: 200 ok. Got: %d %s %s", code, reply.Status, reply.Error)
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+
+	"github.com/quara-dev/letsgo-nats/acme"
+	"github.com/quara-dev/letsgo-nats/configuration"
+	"github.com/quara-dev/letsgo-nats/constants"
+)
+
+var healthcheckUsageStr = `
+Usage: letsgo-nats healthcheck [options]
+Options:
+    -a, --addr <host:port>           Address of NATS client listener (default: 127.0.0.1:4222)
+    -c, --config <file>              Read address of NATS client listener from configuration file
+        --timeout <duration>         Maximum duration of the check (default: 5s)
+`
+
+// Subset of NATS server INFO message
+type serverInfo struct {
+	TLSRequired  bool `json:"tls_required"`
+	TLSAvailable bool `json:"tls_available"`
+}
+
+// Get address of NATS client listener from configuration file
+func clientAddress(configFile string) (string, error) {
+	opts, err := server.ProcessConfigFile(configFile)
+	if err != nil {
+		return "", err
+	}
+	host := opts.Host
+	if isAnyHost(host) {
+		host = "127.0.0.1"
+	}
+	port := opts.Port
+	if port == 0 {
+		port = server.DEFAULT_PORT
+	}
+	if port < 0 {
+		return "", errors.New(fmt.Sprintf("client port of %s is random, use --addr instead", configFile))
+	}
+	return net.JoinHostPort(host, strconv.Itoa(port)), nil
+}
+
+// Connect to NATS client listener, upgrade connection to TLS, and check served certificate
+func checkClientListener(address string, timeout time.Duration, config *configuration.UserConfig) error {
+	conn, err := net.DialTimeout("tcp", address, timeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeout))
+	// NATS server sends INFO before TLS handshake
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		return errors.New(fmt.Sprintf("failed to read INFO from %s: %v", address, err))
+	}
+	if !strings.HasPrefix(line, "INFO ") {
+		return errors.New(fmt.Sprintf("unexpected message from %s: %s", address, strings.TrimSpace(line)))
+	}
+	info := serverInfo{}
+	if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "INFO ")), &info); err != nil {
+		return errors.New(fmt.Sprintf("invalid INFO from %s: %v", address, err))
+	}
+	if !info.TLSRequired && !info.TLSAvailable {
+		return errors.New(fmt.Sprintf("NATS client listener on %s does not use TLS", address))
+	}
+	// Certificate is checked against configured domains instead of trusted roots,
+	// so that certificates issued by staging CA can be checked as well.
+	tlsConn := tls.Client(conn, &tls.Config{
+		ServerName:         config.Domains[0],
+		InsecureSkipVerify: true,
+	})
+	if err := tlsConn.Handshake(); err != nil {
+		return errors.New(fmt.Sprintf("TLS handshake with %s failed: %v", address, err))
+	}
+	certs := tlsConn.ConnectionState().PeerCertificates
+	if len(certs) == 0 {
+		return errors.New(fmt.Sprintf("no certificate served on %s", address))
+	}
+	return acme.CheckServedCertificate(certs[0], config)
+}
+
+// Run healthcheck command and return exit code
+func runHealthcheckCommand(args []string) int {
+	fs := flag.NewFlagSet("healthcheck", flag.ContinueOnError)
+	fs.Usage = func() { fmt.Fprint(os.Stderr, healthcheckUsageStr) }
+	var address, configFile string
+	var timeout time.Duration
+	fs.StringVar(&address, "a", "", "")
+	fs.StringVar(&address, "addr", "", "")
+	fs.StringVar(&configFile, "c", "", "")
+	fs.StringVar(&configFile, "config", "", "")
+	fs.DurationVar(&timeout, "timeout", 5*time.Second, "")
+	if err := fs.Parse(args); err != nil || fs.NArg() > 0 {
+		if err == nil {
+			fs.Usage()
+		}
+		return 2
+	}
+	config, err := configuration.NewOutputConfig()
+	if err == nil && len(config.Domains) == 0 {
+		err = errors.New(fmt.Sprintf("domains of served certificate must be provided through %s environment variable", constants.DOMAINS))
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "letsgo-nats: healthcheck failed: %v\n", err)
+		return 1
+	}
+	if address == "" && configFile != "" {
+		address, err = clientAddress(configFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "letsgo-nats: healthcheck failed: %v\n", err)
+			return 1
+		}
+	}
+	if address == "" {
+		address = net.JoinHostPort("127.0.0.1", strconv.Itoa(server.DEFAULT_PORT))
+	}
+	if err := checkClientListener(address, timeout, config); err != nil {
+		fmt.Fprintf(os.Stderr, "letsgo-nats: healthcheck failed: %v\n", err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+
+	"github.com/quara-dev/letsgo-nats/acme"
+	"github.com/quara-dev/letsgo-nats/configuration"
+	"github.com/quara-dev/letsgo-nats/constants"
+)
+
+// Start a NATS server serving managed certificates on its client listener, and return its address
+func runTestTLSServer(t *testing.T, config *configuration.UserConfig) string {
+	certFile, keyFile := acme.CertificatePaths(config)
+	configFile := writeTestNATSConfig(t, fmt.Sprintf("listen: \"127.0.0.1:-1\"\ntls {\n  cert_file: %q\n  key_file: %q\n}\n", certFile, keyFile))
+	opts, err := server.ProcessConfigFile(configFile)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	return runTestServer(t, opts).Addr().String()
+}
+
+// Test that certificates served by NATS client listener are checked
+func TestCheckClientListener(t *testing.T) {
+	valid := newTestConfig(t)
+	writeTestCertificate(t, valid, time.Now().Add(-time.Hour), time.Now().Add(24*time.Hour))
+	expired := newTestConfig(t)
+	writeTestCertificate(t, expired, time.Now().Add(-48*time.Hour), time.Now().Add(-24*time.Hour))
+	plain, err := server.ProcessConfigFile(writeTestNATSConfig(t, "listen: \"127.0.0.1:-1\"\n"))
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	tests := []struct {
+		name    string
+		address string
+		domains string
+		err     string
+	}{
+		{"valid", runTestTLSServer(t, valid), "example.com", ""},
+		{"domain mismatch", runTestTLSServer(t, valid), "example.com,other.example.com", "certificate does not cover domain other.example.com"},
+		{"expired", runTestTLSServer(t, expired), "example.com", "certificate for example.com is not valid"},
+		{"plain", runTestServer(t, plain).Addr().String(), "example.com", "does not use TLS"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := &configuration.UserConfig{Domains: strings.Split(test.domains, ",")}
+			err := checkClientListener(test.address, 2*time.Second, config)
+			if test.err == "" && err != nil {
+				t.Errorf(err.Error())
+			}
+			if test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)) {
+				t.Errorf("Bad error. Want: %s. Got: %v", test.err, err)
+			}
+			// Healthcheck command exits with status 1 when check fails
+			t.Setenv(constants.DOMAINS, test.domains)
+			code_want := 0
+			if test.err != "" {
+				code_want = 1
+			}
+			if code := runHealthcheckCommand([]string{"-a", test.address, "--timeout", "2s"}); code != code_want {
+				t.Errorf("Bad exit code. Want: %d. Got: %d", code_want, code)
+			}
+		})
+	}
+}
@@ -1,52 +1,79 @@
 package main
 
 import (
-	"context"
 	"flag"
 	"fmt"
-	"log"
+	"net"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/nats-io/nats-server/v2/server"
 
-	"github.com/procyon-projects/chrono"
 	"go.uber.org/automaxprocs/maxprocs"
 
 	"github.com/quara-dev/letsgo-nats/acme"
 	"github.com/quara-dev/letsgo-nats/configuration"
+	"github.com/quara-dev/letsgo-nats/constants"
 	"github.com/quara-dev/letsgo-nats/stores"
 )
 
-// Certificates expiring in less than 21 days are renewed
-const MINIMUM_REMAINING_DAYS = 21
-const INITIAL_MINIMUM_REMAINING_DAYS = 21
-
-func startRenewTask(ns *server.Server, config *configuration.UserConfig) {
-	taskScheduler := chrono.NewDefaultTaskScheduler()
-
-	_, err := taskScheduler.ScheduleWithFixedDelay(func(ctx context.Context) {
-		ns.Debugf("Checking certificate expiration")
-		renewed, err := acme.GetOrRenewCertificate(config, MINIMUM_REMAINING_DAYS)
-		if err != nil {
-			ns.Errorf("Failed to renew TLS certificates")
-		} else if renewed {
-			ns.Noticef("Reloading NATS server due to TLS certificates changes")
-			ns.Reload()
-		} else {
-			ns.Noticef("Skipping TLS certificate request. Certificate is still valid for more than %d days", MINIMUM_REMAINING_DAYS)
-		}
-	}, 24*time.Hour)
-
+// Check that the ACME challenge listener does not conflict with NATS listeners.
+//
+// Both can be configured on the same host as long as they do not share a port,
+// because the challenge listener is only started while an order is pending.
+func checkChallengeListener(opts *server.Options, config *configuration.UserConfig) error {
+	var address string
+	switch config.Challenge {
+	case constants.ACME_CHALLENGE_HTTP01:
+		address = config.HTTPAddress
+	case constants.ACME_CHALLENGE_TLSALPN01:
+		address = config.TLSAddress
+	default:
+		return nil
+	}
+	host, port, err := net.SplitHostPort(address)
 	if err != nil {
-		ns.Fatalf("Failed to schedule certificate renewal task")
-	} else {
-		ns.Noticef("Certificates will be checked for renewal each day")
+		return err
+	}
+	listeners := []struct {
+		name string
+		host string
+		port int
+	}{
+		{"client", opts.Host, opts.Port},
+		{"HTTP monitoring", opts.HTTPHost, opts.HTTPPort},
+		{"HTTPS monitoring", opts.HTTPHost, opts.HTTPSPort},
+		{"websocket", opts.Websocket.Host, opts.Websocket.Port},
+		{"MQTT", opts.MQTT.Host, opts.MQTT.Port},
+		{"leafnode", opts.LeafNode.Host, opts.LeafNode.Port},
+		{"gateway", opts.Gateway.Host, opts.Gateway.Port},
+		{"cluster", opts.Cluster.Host, opts.Cluster.Port},
 	}
+	for _, listener := range listeners {
+		if listener.port <= 0 || strconv.Itoa(listener.port) != port {
+			continue
+		}
+		if isAnyHost(host) || isAnyHost(listener.host) || host == listener.host {
+			return fmt.Errorf("%s challenge address %s conflicts with NATS %s port %d", strings.ToUpper(config.Challenge), address, listener.name, listener.port)
+		}
+	}
+	return nil
+}
+
+// Check if a listener host binds all interfaces
+func isAnyHost(host string) bool {
+	return host == "" || host == "0.0.0.0" || host == "::"
 }
 
 var usageStr = `
 Usage: letsgo-nats [options]
+       letsgo-nats cert (status|history|renew [--force]|revoke [--reason <reason>])
+       letsgo-nats account (show|register)
+       letsgo-nats healthcheck [-a <host:port>] [-c <file>] [--timeout <duration>]
+       letsgo-nats sidecar [-P <pid>] [-D]
+       letsgo-nats supervisor [--nats-server <path>] [-D] [-- <nats-server options>]
 Server Options:
     -a, --addr, --net <host>         Bind to host address (default: 0.0.0.0)
     -p, --port <port>                Use port for clients (default: 4222)
@@ -108,46 +135,138 @@ func usage() {
 	os.Exit(0)
 }
 
+// Create a FlagSet and sets the usage
+func newFlagSet(exe string) *flag.FlagSet {
+	fs := flag.NewFlagSet(exe, flag.ExitOnError)
+	fs.Usage = usage
+	return fs
+}
+
+// Configure NATS options from the flags/config file
+func configureOptions(fs *flag.FlagSet) (*server.Options, error) {
+	return server.ConfigureOptions(fs, os.Args[1:],
+		server.PrintServerAndExit,
+		fs.Usage,
+		server.PrintTLSHelpAndDie)
+}
+
 func main() {
 
 	exe := "letsgo-nats"
 
-	// Create a FlagSet and sets the usage
-	fs := flag.NewFlagSet(exe, flag.ExitOnError)
-	fs.Usage = usage
+	// Run certificate management commands without starting NATS server
+	if len(os.Args) > 1 && os.Args[1] == "cert" {
+		os.Exit(runCertCommand(os.Args[2:]))
+	}
+	// Run ACME account management commands without starting NATS server
+	if len(os.Args) > 1 && os.Args[1] == "account" {
+		os.Exit(runAccountCommand(os.Args[2:]))
+	}
+	// Check served certificate of a running NATS server
+	if len(os.Args) > 1 && os.Args[1] == "healthcheck" {
+		os.Exit(runHealthcheckCommand(os.Args[2:]))
+	}
+	// Manage certificates of a NATS server running in another process
+	if len(os.Args) > 1 && os.Args[1] == "sidecar" {
+		os.Exit(runSidecarCommand(os.Args[2:]))
+	}
+	// Launch a NATS server binary as a child process and manage its certificates
+	if len(os.Args) > 1 && os.Args[1] == "supervisor" {
+		os.Exit(runSupervisorCommand(os.Args[2:]))
+	}
+
+	// Configure the options from the flags/config file.
+	// Informational flags (help, version, signal) are handled here, before
+	// letsgo configuration is processed, so that they work offline.
+	fs := newFlagSet(exe)
+	opts, err := configureOptions(fs)
+
+	// Find TLS certificate files referenced by NATS configuration
+	files, filesErr := findTLSFiles(fs)
+	if filesErr != nil {
+		// Report NATS error first when configuration file is invalid
+		if err == nil {
+			err = filesErr
+		}
+		server.PrintAndDie(fmt.Sprintf("%s: %s", exe, err))
+	}
+	// Only OUTPUT_DIRECTORY and FILENAME are needed to find managed certificate files.
+	// Testing a configuration which does not use TLS files requires none of them.
+	output, outputErr := configuration.NewOutputConfig()
+	if outputErr != nil && (len(files) > 0 || flagValue(fs, "t") != "true") {
+		server.PrintAndDie(fmt.Sprintf("%s: %s", exe, outputErr))
+	}
+	// NATS options cannot be parsed until managed certificates referenced by NATS configuration exist
+	deferred := err != nil && onlyMissingFiles(err, missingManagedFiles(files, output))
+	if flagValue(fs, "t") == "true" {
+		// Report mismatching TLS files first, since they are likely the cause of NATS errors
+		if err := checkTLSFiles(files, output); err != nil {
+			server.PrintAndDie(fmt.Sprintf("%s: %s", exe, err))
+		}
+		if err != nil && !deferred {
+			server.PrintAndDie(fmt.Sprintf("%s: %s", exe, err))
+		}
+		if deferred {
+			fmt.Fprintf(os.Stderr, "%s: configuration file %s is valid. Managed TLS certificates do not exist yet and will be requested on startup\n", exe, flagValue(fs, "c"))
+		} else {
+			fmt.Fprintf(os.Stderr, "%s: configuration file %s is valid\n", exe, opts.ConfigFile)
+		}
+		os.Exit(0)
+	}
+	if err != nil && !deferred {
+		server.PrintAndDie(fmt.Sprintf("%s: %s", exe, err))
+	}
 
 	// Process letsgo configuration
 	stores := stores.DefaultStores()
 	// Generate config for user
 	config, err := configuration.NewUserConfig(&stores)
 	if err != nil {
-		log.Fatal(err)
+		server.PrintAndDie(fmt.Sprintf("%s: %s", exe, err))
 	}
-	// Generate TLS certificates using letsgo
-	// Certificate is renewed if either:
-	//   * renewed if it expires before 21 days
-	//   * created if it does not exist yet
-	//   * left untouched if it is still valid for more than 21 days
-	_, err = acme.GetOrRenewCertificate(config, INITIAL_MINIMUM_REMAINING_DAYS)
-	if err != nil {
-		log.Fatal(err)
+	// Collect certificate events, including events emitted before NATS server is started
+	var events *eventPublisher
+	if config.EventsSubject != "" {
+		events = newEventPublisher(config)
 	}
-
-	// Configure the options from the flags/config file
-	opts, err := server.ConfigureOptions(fs, os.Args[1:],
-		server.PrintServerAndExit,
-		fs.Usage,
-		server.PrintTLSHelpAndDie)
+	// Make sure challenges can be solved while NATS is running, before any order is placed.
+	// Options of a deferred configuration are only known once managed certificates exist.
+	if !deferred {
+		if err := checkChallengeListener(opts, config); err != nil {
+			server.PrintAndDie(fmt.Sprintf("%s: %s", exe, err))
+		}
+	}
+	// Generate TLS certificates using letsgo
+	startup, err := getStartupCertificates(config)
 	if err != nil {
 		server.PrintAndDie(fmt.Sprintf("%s: %s", exe, err))
-	} else if opts.CheckConfig {
-		fmt.Fprintf(os.Stderr, "%s: configuration file %s is valid\n", exe, opts.ConfigFile)
-		os.Exit(0)
 	}
-	// I don't know how to access path to TLS certificates, only how to access already parsed x509 certificates
-	// log.Printf("TLS Certificate: %s", opts.TLSConfig.Certificates)
-	// log.Printf("TLS Key: %s", opts.TLSConfig.Certificates)
-	// So we cannot process configuration BEFORE generating TLS certificates...
+	// Parse NATS options again now that managed certificates exist
+	if deferred {
+		fs = newFlagSet(exe)
+		opts, err = configureOptions(fs)
+		if err != nil {
+			server.PrintAndDie(fmt.Sprintf("%s: %s", exe, err))
+		}
+		if err := checkChallengeListener(opts, config); err != nil {
+			server.PrintAndDie(fmt.Sprintf("%s: %s", exe, err))
+		}
+	}
+	// Use managed certificates on NATS listeners listed in TLS_LISTENERS
+	var holder *acme.CertificateHolder
+	if len(config.TLSListeners) > 0 {
+		holder, err = acme.NewCertificateHolder(config)
+		if err != nil {
+			server.PrintAndDie(fmt.Sprintf("%s: %s", exe, err))
+		}
+		if err := injectTLSConfig(opts, config, holder); err != nil {
+			server.PrintAndDie(fmt.Sprintf("%s: %s", exe, err))
+		}
+	}
+	// NATS server must not reload configuration file without managed certificates
+	if replacesSignals(config) {
+		opts.NoSigs = true
+	}
 
 	// Create the server with appropriate options.
 	ns, err := server.NewServer(opts)
@@ -158,6 +277,10 @@ func main() {
 	// Configure the logger based on the flags
 	ns.ConfigureLogger()
 
+	if replacesSignals(config) {
+		handleSignals(ns, opts.ConfigFile, config, holder)
+	}
+
 	// Start things up. Block here until done.
 	if err := server.Run(ns); err != nil {
 		server.PrintAndDie(err.Error())
@@ -167,8 +290,24 @@ func main() {
 	if !ns.ReadyForConnections(4 * time.Second) {
 		server.PrintAndDie("NATS server is not ready for connection before timeout (4s)")
 	}
-	// Start certificate renewal task
-	startRenewTask(ns, config)
+	if events != nil {
+		if err := events.connect(ns, config); err != nil {
+			ns.Errorf("Failed to publish certificate events: %v", err)
+		}
+	}
+	// NATS server started without configuration file cannot be reloaded
+	var reload func() error
+	if opts.ConfigFile != "" {
+		reload = ns.Reload
+	}
+	// Certificates were loaded by NATS server
+	task := startup.manage(ns, ns, holder, reload)
+	// Expose certificate state and operations on NATS system account
+	if config.AdminUser != "" {
+		if err := startAdminService(ns, config, task); err != nil {
+			ns.Errorf("Failed to start admin service: %v", err)
+		}
+	}
 
 	// Adjust MAXPROCS if running under linux/cgroups quotas.
 	undo, err := maxprocs.Set(maxprocs.Logger(ns.Debugf))
@@ -176,8 +315,6 @@ func main() {
 		ns.Warnf("Failed to set GOMAXPROCS: %v", err)
 	} else {
 		defer undo()
-		// Reset these from the snapshots from init for monitor.go
-		server.SnapshotMonitorInfo()
 	}
 
 	ns.WaitForShutdown()
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+
+	"github.com/quara-dev/letsgo-nats/acme"
+	"github.com/quara-dev/letsgo-nats/configuration"
+	"github.com/quara-dev/letsgo-nats/metrics"
+)
+
+var natsReloads = metrics.NewCounter(
+	"letsgo_nats_reloads_total",
+	"Number of attempts to use renewed certificates, by outcome (success, unsignaled, skipped, pending, restored or failure).",
+	"outcome",
+)
+
+// Export seconds until expiry of certificates currently in use
+func registerExpiryMetric(config *configuration.UserConfig) {
+	metrics.NewGaugeFunc(
+		"letsgo_certificate_expiry_seconds",
+		"Number of seconds until expiry of the certificate currently in use.",
+		func() []metrics.Sample {
+			samples := []metrics.Sample{}
+			certs, err := acme.CurrentCertificates(config)
+			if err != nil {
+				return samples
+			}
+			for _, cert := range certs {
+				samples = append(samples, metrics.Sample{
+					Labels: []string{cert.Filename},
+					Value:  time.Until(cert.NotAfter).Seconds(),
+				})
+			}
+			return samples
+		},
+		"filename",
+	)
+}
+
+// Start HTTP listeners serving Prometheus metrics on /metrics, and probes on /healthz and /readyz.
+//
+// Metrics and probes are served by the same listener when they use the same address.
+// ns is nil in sidecar mode, where NATS server runs in another process.
+func startHTTPListeners(log server.Logger, ns *server.Server, config *configuration.UserConfig, holder *acme.CertificateHolder, task *renewTask) error {
+	muxes := map[string]*http.ServeMux{}
+	mux := func(address string) *http.ServeMux {
+		if _, ok := muxes[address]; !ok {
+			muxes[address] = http.NewServeMux()
+		}
+		return muxes[address]
+	}
+	if config.MetricsAddress != "" {
+		registerExpiryMetric(config)
+		mux(config.MetricsAddress).Handle("/metrics", metrics.DefaultRegistry.Handler())
+	}
+	if config.HealthAddress != "" {
+		p := &probes{ns: ns, config: config, holder: holder, task: task}
+		p.register(mux(config.HealthAddress))
+	}
+	for address, handler := range muxes {
+		listener, err := net.Listen("tcp", address)
+		if err != nil {
+			return err
+		}
+		go func(listener net.Listener, handler http.Handler) {
+			if err := http.Serve(listener, handler); err != nil {
+				log.Errorf("HTTP listener on %s stopped: %v", listener.Addr(), err)
+			}
+		}(listener, handler)
+		log.Noticef("Listening for metrics and probes requests on %s", listener.Addr())
+	}
+	return nil
+}
@@ -0,0 +1,259 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Metrics exposed using Prometheus text format.
+//
+// Only the features needed by letsgo are implemented: counters, histograms
+// and gauges computed on collection, all with optional labels.
+
+// A labelled value of a metric
+type Sample struct {
+	Labels []string
+	Value  float64
+}
+
+// A metric family, i.e. a metric name with all its labelled values
+type metric interface {
+	write(w io.Writer)
+}
+
+// Registry holding metrics, in registration order
+type Registry struct {
+	mu      sync.Mutex
+	metrics []metric
+}
+
+// Registry used by default
+var DefaultRegistry = &Registry{}
+
+func (r *Registry) register(m metric) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.metrics = append(r.metrics, m)
+}
+
+// Write all metrics using Prometheus text format
+func (r *Registry) Write(w io.Writer) {
+	r.mu.Lock()
+	metrics := append([]metric{}, r.metrics...)
+	r.mu.Unlock()
+	for _, m := range metrics {
+		m.write(w)
+	}
+}
+
+// Get an HTTP handler serving metrics of registry
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		r.Write(w)
+	})
+}
+
+// Write header of a metric family
+func writeHeader(w io.Writer, name string, help string, kind string) {
+	fmt.Fprintf(w, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(w, "# TYPE %s %s\n", name, kind)
+}
+
+// Format label names and values, e.g. {filename="example.com"}
+func formatLabels(names []string, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	pairs := []string{}
+	for i, name := range names {
+		value := ""
+		if i < len(values) {
+			value = values[i]
+		}
+		value = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, name, value))
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// Format a sample value
+func formatValue(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+// Key of a labelled value
+func labelsKey(values []string) string {
+	return strings.Join(values, "\xff")
+}
+
+// Counter with labels
+type Counter struct {
+	name   string
+	help   string
+	labels []string
+
+	mu     sync.Mutex
+	values map[string]*Sample
+}
+
+// Create and register a counter
+func NewCounter(name string, help string, labels ...string) *Counter {
+	c := &Counter{name: name, help: help, labels: labels, values: map[string]*Sample{}}
+	DefaultRegistry.register(c)
+	return c
+}
+
+// Increment counter for label values
+func (c *Counter) Inc(values ...string) {
+	c.Add(1, values...)
+}
+
+// Add to counter for label values
+func (c *Counter) Add(delta float64, values ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	key := labelsKey(values)
+	sample, ok := c.values[key]
+	if !ok {
+		sample = &Sample{Labels: values}
+		c.values[key] = sample
+	}
+	sample.Value += delta
+}
+
+// Get counter value for label values
+func (c *Counter) Value(values ...string) float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if sample, ok := c.values[labelsKey(values)]; ok {
+		return sample.Value
+	}
+	return 0
+}
+
+func (c *Counter) write(w io.Writer) {
+	writeHeader(w, c.name, c.help, "counter")
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	keys := []string{}
+	for key := range c.values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		sample := c.values[key]
+		fmt.Fprintf(w, "%s%s %s\n", c.name, formatLabels(c.labels, sample.Labels), formatValue(sample.Value))
+	}
+}
+
+// Histogram with labels
+type Histogram struct {
+	name    string
+	help    string
+	labels  []string
+	buckets []float64
+
+	mu     sync.Mutex
+	values map[string]*histogramValue
+}
+
+type histogramValue struct {
+	labels []string
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+// Create and register an histogram. Buckets are upper bounds, in increasing order.
+func NewHistogram(name string, help string, buckets []float64, labels ...string) *Histogram {
+	h := &Histogram{name: name, help: help, labels: labels, buckets: buckets, values: map[string]*histogramValue{}}
+	DefaultRegistry.register(h)
+	return h
+}
+
+// Observe a value for label values
+func (h *Histogram) Observe(value float64, values ...string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	key := labelsKey(values)
+	v, ok := h.values[key]
+	if !ok {
+		v = &histogramValue{labels: values, counts: make([]uint64, len(h.buckets))}
+		h.values[key] = v
+	}
+	for i, bound := range h.buckets {
+		if value <= bound {
+			v.counts[i] += 1
+		}
+	}
+	v.count += 1
+	v.sum += value
+}
+
+// Get number of observations for label values
+func (h *Histogram) Count(values ...string) uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if v, ok := h.values[labelsKey(values)]; ok {
+		return v.count
+	}
+	return 0
+}
+
+func (h *Histogram) write(w io.Writer) {
+	writeHeader(w, h.name, h.help, "histogram")
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	keys := []string{}
+	for key := range h.values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	names := append(append([]string{}, h.labels...), "le")
+	for _, key := range keys {
+		v := h.values[key]
+		for i, bound := range h.buckets {
+			labels := append(append([]string{}, v.labels...), formatValue(bound))
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, formatLabels(names, labels), v.counts[i])
+		}
+		labels := append(append([]string{}, v.labels...), "+Inf")
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, formatLabels(names, labels), v.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, formatLabels(h.labels, v.labels), formatValue(v.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, formatLabels(h.labels, v.labels), v.count)
+	}
+}
+
+// Gauge computed each time metrics are collected
+type GaugeFunc struct {
+	name    string
+	help    string
+	labels  []string
+	collect func() []Sample
+}
+
+// Create and register a gauge computed by collect
+func NewGaugeFunc(name string, help string, collect func() []Sample, labels ...string) *GaugeFunc {
+	g := &GaugeFunc{name: name, help: help, labels: labels, collect: collect}
+	DefaultRegistry.register(g)
+	return g
+}
+
+func (g *GaugeFunc) write(w io.Writer) {
+	writeHeader(w, g.name, g.help, "gauge")
+	for _, sample := range g.collect() {
+		fmt.Fprintf(w, "%s%s %s\n", g.name, formatLabels(g.labels, sample.Labels), formatValue(sample.Value))
+	}
+}
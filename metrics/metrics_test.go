@@ -0,0 +1,48 @@
+package metrics
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestWriteMetrics(t *testing.T) {
+	registry := &Registry{}
+	counter := &Counter{name: "test_failures_total", help: "Failures.", labels: []string{"reason"}, values: map[string]*Sample{}}
+	histogram := &Histogram{name: "test_duration_seconds", help: "Duration.", buckets: []float64{1, 10}, values: map[string]*histogramValue{}}
+	gauge := &GaugeFunc{name: "test_expiry_seconds", help: "Expiry.", labels: []string{"filename"}, collect: func() []Sample {
+		return []Sample{{Labels: []string{`a"b`}, Value: 42}}
+	}}
+	registry.register(counter)
+	registry.register(histogram)
+	registry.register(gauge)
+
+	counter.Inc("order")
+	counter.Inc("order")
+	counter.Inc("install")
+	histogram.Observe(0.5)
+	histogram.Observe(5)
+
+	var out bytes.Buffer
+	registry.Write(&out)
+	want := `# HELP test_failures_total Failures.
+# TYPE test_failures_total counter
+test_failures_total{reason="install"} 1
+test_failures_total{reason="order"} 2
+# HELP test_duration_seconds Duration.
+# TYPE test_duration_seconds histogram
+test_duration_seconds_bucket{le="1"} 1
+test_duration_seconds_bucket{le="10"} 2
+test_duration_seconds_bucket{le="+Inf"} 2
+test_duration_seconds_sum 5.5
+test_duration_seconds_count 2
+# HELP test_expiry_seconds Expiry.
+# TYPE test_expiry_seconds gauge
+test_expiry_seconds{filename="a\"b"} 42
+`
+	if out.String() != want {
+		t.Errorf("Bad metrics. Want:\n%s\nGot:\n%s", want, out.String())
+	}
+	if counter.Value("order") != 2 {
+		t.Errorf("Bad counter value. Want: 2. Got: %f", counter.Value("order"))
+	}
+}
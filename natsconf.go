@@ -0,0 +1,170 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/nats-io/nats-server/v2/conf"
+	"golang.org/x/exp/slices"
+
+	"github.com/quara-dev/letsgo-nats/acme"
+	"github.com/quara-dev/letsgo-nats/configuration"
+	"github.com/quara-dev/letsgo-nats/constants"
+)
+
+// TLS certificate files configured for a NATS listener
+type tlsFiles struct {
+	listener string
+	certFile string
+	keyFile  string
+}
+
+// Get value of a parsed flag, or an empty string when flag is not defined
+func flagValue(fs *flag.FlagSet, name string) string {
+	f := fs.Lookup(name)
+	if f == nil {
+		return ""
+	}
+	return f.Value.String()
+}
+
+// Get a configuration block, keys being case insensitive as in NATS configuration
+func lookupBlock(block map[string]interface{}, keys ...string) map[string]interface{} {
+	for key, value := range block {
+		if !slices.Contains(keys, strings.ToLower(key)) {
+			continue
+		}
+		if child, ok := value.(map[string]interface{}); ok {
+			return child
+		}
+	}
+	return nil
+}
+
+// Get a string value of a configuration block, keys being case insensitive
+func lookupString(block map[string]interface{}, key string) string {
+	for k, value := range block {
+		if strings.ToLower(k) == key {
+			if s, ok := value.(string); ok {
+				return s
+			}
+		}
+	}
+	return ""
+}
+
+// Find TLS certificate files configured for NATS listeners, either in configuration file or using flags
+func findTLSFiles(fs *flag.FlagSet) ([]tlsFiles, error) {
+	files := []tlsFiles{}
+	if certFile := flagValue(fs, "tlscert"); certFile != "" {
+		files = append(files, tlsFiles{constants.TLS_LISTENER_CLIENT, certFile, flagValue(fs, "tlskey")})
+	}
+	configFile := flagValue(fs, "c")
+	if configFile == "" {
+		return files, nil
+	}
+	// Configuration is parsed without loading certificates, which may not exist yet
+	root, err := conf.ParseFile(configFile)
+	if err != nil {
+		return nil, err
+	}
+	listeners := []struct {
+		name  string
+		block map[string]interface{}
+	}{
+		{constants.TLS_LISTENER_CLIENT, root},
+		{constants.TLS_LISTENER_WEBSOCKET, lookupBlock(root, "websocket", "ws")},
+		{constants.TLS_LISTENER_MQTT, lookupBlock(root, "mqtt")},
+		{constants.TLS_LISTENER_LEAFNODE, lookupBlock(root, "leafnodes", "leaf")},
+		{constants.TLS_LISTENER_GATEWAY, lookupBlock(root, "gateway")},
+	}
+	for _, listener := range listeners {
+		block := lookupBlock(listener.block, "tls")
+		if block == nil {
+			continue
+		}
+		certFile := lookupString(block, "cert_file")
+		keyFile := lookupString(block, "key_file")
+		if certFile != "" || keyFile != "" {
+			files = append(files, tlsFiles{listener.name, certFile, keyFile})
+		}
+	}
+	return files, nil
+}
+
+// Check that TLS certificate files configured for NATS listeners are managed certificate files.
+//
+// Listeners listed in TLS_LISTENERS are not checked, because managed certificates
+// are injected in place of configured files.
+func checkTLSFiles(files []tlsFiles, config *configuration.UserConfig) error {
+	messages := []string{}
+	for _, f := range files {
+		if slices.Contains(config.TLSListeners, f.listener) {
+			continue
+		}
+		certFile, _ := filepath.Abs(f.certFile)
+		keyFile, _ := filepath.Abs(f.keyFile)
+		expected := []string{}
+		found := false
+		for _, certConfig := range acme.CertificateConfigs(config) {
+			wantCert, wantKey := acme.CertificatePaths(certConfig)
+			expected = append(expected, fmt.Sprintf("%s and %s", wantCert, wantKey))
+			if certFile == wantCert && keyFile == wantKey {
+				found = true
+			}
+		}
+		if !found {
+			messages = append(messages, fmt.Sprintf("%s TLS configuration uses %s and %s, which do not match %s and %s. Expected %s", f.listener, f.certFile, f.keyFile, constants.OUTPUT_DIRECTORY, constants.FILENAME, strings.Join(expected, " or ")))
+		}
+	}
+	if len(messages) > 0 {
+		return errors.New(strings.Join(messages, "; "))
+	}
+	return nil
+}
+
+// Get TLS certificate files configured for NATS listeners which are managed but do not exist yet
+func missingManagedFiles(files []tlsFiles, config *configuration.UserConfig) []string {
+	managed := []string{}
+	for _, certConfig := range acme.CertificateConfigs(config) {
+		certFile, keyFile := acme.CertificatePaths(certConfig)
+		managed = append(managed, certFile, keyFile)
+	}
+	missing := []string{}
+	for _, f := range files {
+		for _, path := range []string{f.certFile, f.keyFile} {
+			abs, _ := filepath.Abs(path)
+			if !slices.Contains(managed, abs) {
+				continue
+			}
+			if _, err := os.Stat(abs); errors.Is(err, os.ErrNotExist) && !slices.Contains(missing, path) {
+				missing = append(missing, path)
+			}
+		}
+	}
+	return missing
+}
+
+// Check whether NATS options failed to be parsed only because of missing managed certificate files
+func onlyMissingFiles(err error, missing []string) bool {
+	if len(missing) == 0 {
+		return false
+	}
+	for _, line := range strings.Split(strings.TrimSpace(err.Error()), "\n") {
+		found := false
+		for _, path := range missing {
+			if strings.Contains(line, path) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+
+	"github.com/quara-dev/letsgo-nats/acme"
+	"github.com/quara-dev/letsgo-nats/constants"
+)
+
+// Parse NATS flags needed to find TLS files
+func newTestFlagSet(t *testing.T, args ...string) *flag.FlagSet {
+	fs := flag.NewFlagSet("letsgo-nats", flag.ContinueOnError)
+	fs.String("c", "", "")
+	fs.String("tlscert", "", "")
+	fs.String("tlskey", "", "")
+	if err := fs.Parse(args); err != nil {
+		t.Fatalf(err.Error())
+	}
+	return fs
+}
+
+// Write a NATS configuration file in a temporary directory
+func writeTestNATSConfig(t *testing.T, content string) string {
+	configFile := filepath.Join(t.TempDir(), "nats.conf")
+	if err := os.WriteFile(configFile, []byte(content), 0o600); err != nil {
+		t.Fatalf(err.Error())
+	}
+	return configFile
+}
+
+// Get path of a file relative to working directory
+func relativePath(t *testing.T, path string) string {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	rel, err := filepath.Rel(wd, path)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	return rel
+}
+
+// Test that TLS files are found for each listener, including block aliases
+func TestFindTLSFiles(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   string
+		args     []string
+		listener string
+	}{
+		{"flags", "", []string{"--tlscert", "server.crt", "--tlskey", "server.key"}, constants.TLS_LISTENER_CLIENT},
+		{"client", "tls { cert_file: server.crt, key_file: server.key }", nil, constants.TLS_LISTENER_CLIENT},
+		{"case insensitive", "TLS { Cert_File: server.crt, KEY_FILE: server.key }", nil, constants.TLS_LISTENER_CLIENT},
+		{"websocket", "websocket { port: 8080, tls { cert_file: server.crt, key_file: server.key } }", nil, constants.TLS_LISTENER_WEBSOCKET},
+		{"ws", "ws { port: 8080, tls { cert_file: server.crt, key_file: server.key } }", nil, constants.TLS_LISTENER_WEBSOCKET},
+		{"mqtt", "mqtt { port: 1883, tls { cert_file: server.crt, key_file: server.key } }", nil, constants.TLS_LISTENER_MQTT},
+		{"leafnodes", "leafnodes { port: 7422, tls { cert_file: server.crt, key_file: server.key } }", nil, constants.TLS_LISTENER_LEAFNODE},
+		{"leaf", "leaf { port: 7422, tls { cert_file: server.crt, key_file: server.key } }", nil, constants.TLS_LISTENER_LEAFNODE},
+		{"gateway", "gateway { name: a, port: 7522, tls { cert_file: server.crt, key_file: server.key } }", nil, constants.TLS_LISTENER_GATEWAY},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			args := test.args
+			if test.config != "" {
+				args = append(args, "-c", writeTestNATSConfig(t, test.config))
+			}
+			files, err := findTLSFiles(newTestFlagSet(t, args...))
+			if err != nil {
+				t.Fatalf(err.Error())
+			}
+			if len(files) != 1 {
+				t.Fatalf("Bad number of TLS files. Want: 1. Got: %d", len(files))
+			}
+			want := tlsFiles{test.listener, "server.crt", "server.key"}
+			if files[0] != want {
+				t.Errorf("Bad TLS files. Want: %+v. Got: %+v", want, files[0])
+			}
+		})
+	}
+}
+
+// Test that TLS files without tls block and invalid configuration files are handled
+func TestFindTLSFilesNone(t *testing.T) {
+	files, err := findTLSFiles(newTestFlagSet(t, "-c", writeTestNATSConfig(t, "port: 4222\nwebsocket { port: 8080, no_tls: true }\n")))
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if len(files) != 0 {
+		t.Errorf("Bad number of TLS files. Want: 0. Got: %d", len(files))
+	}
+	_, err = findTLSFiles(newTestFlagSet(t, "-c", writeTestNATSConfig(t, "tls {")))
+	if err == nil {
+		t.Errorf("Invalid configuration file was not detected")
+	}
+}
+
+// Test that TLS files configured for NATS listeners are compared with managed files
+func TestCheckTLSFiles(t *testing.T) {
+	config := newTestConfig(t)
+	config.AdditionalKeyTypes = nil
+	certFile, keyFile := acme.CertificatePaths(config)
+	tests := []struct {
+		name      string
+		files     tlsFiles
+		listeners []string
+		valid     bool
+	}{
+		{"absolute", tlsFiles{constants.TLS_LISTENER_CLIENT, certFile, keyFile}, nil, true},
+		{"relative", tlsFiles{constants.TLS_LISTENER_CLIENT, relativePath(t, certFile), relativePath(t, keyFile)}, nil, true},
+		{"unclean", tlsFiles{constants.TLS_LISTENER_WEBSOCKET, filepath.Join(config.OutputDirectory, ".", "x", "..", "example.com.crt"), keyFile}, nil, true},
+		{"other files", tlsFiles{constants.TLS_LISTENER_LEAFNODE, "/etc/nats/server.crt", "/etc/nats/server.key"}, nil, false},
+		{"other key", tlsFiles{constants.TLS_LISTENER_CLIENT, certFile, "/etc/nats/server.key"}, nil, false},
+		{"injected", tlsFiles{constants.TLS_LISTENER_LEAFNODE, "/etc/nats/server.crt", "/etc/nats/server.key"}, []string{constants.TLS_LISTENER_LEAFNODE}, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config.TLSListeners = test.listeners
+			err := checkTLSFiles([]tlsFiles{test.files}, config)
+			if test.valid && err != nil {
+				t.Errorf(err.Error())
+			}
+			if !test.valid && err == nil {
+				t.Errorf("Mismatching TLS files were not detected")
+			}
+			if !test.valid && err != nil && !strings.HasPrefix(err.Error(), test.files.listener+" TLS configuration uses") {
+				t.Errorf("Bad error: %v", err)
+			}
+		})
+	}
+}
+
+// Test that startup is only deferred when NATS configuration fails because managed certificates do not exist yet
+func TestOnlyMissingFiles(t *testing.T) {
+	config := newTestConfig(t)
+	certFile, keyFile := acme.CertificatePaths(config)
+	other := newTestConfig(t)
+	other.Domains = []string{"other.example.com"}
+	writeTestCertificate(t, other, time.Now().Add(-time.Hour), time.Now().Add(24*time.Hour))
+	otherCert, otherKey := acme.CertificatePaths(other)
+	tests := []struct {
+		name     string
+		config   string
+		deferred bool
+	}{
+		{"absolute", fmt.Sprintf("tls { cert_file: %q, key_file: %q }", certFile, keyFile), true},
+		{"relative", fmt.Sprintf("tls { cert_file: %q, key_file: %q }", relativePath(t, certFile), relativePath(t, keyFile)), true},
+		{"websocket", fmt.Sprintf("ws { port: 8080, tls { cert_file: %q, key_file: %q } }", certFile, keyFile), true},
+		{"leafnodes", fmt.Sprintf("leafnodes { port: 7422, tls { cert_file: %q, key_file: %q } }", certFile, keyFile), true},
+		{"leaf", fmt.Sprintf("leaf { port: 7422, tls { cert_file: %q, key_file: %q } }", certFile, keyFile), true},
+		{"unmanaged files", "tls { cert_file: /nonexistent/server.crt, key_file: /nonexistent/server.key }", false},
+		{"existing unmanaged files with config error", fmt.Sprintf("tls { cert_file: %q, key_file: %q }\nmax_payload: \"abc\"", otherCert, otherKey), false},
+		{"config error", fmt.Sprintf("tls { cert_file: %q, key_file: %q }\nmax_payload: \"abc\"", certFile, keyFile), false},
+		{"config error in listener", fmt.Sprintf("websocket { port: \"abc\", tls { cert_file: %q, key_file: %q } }", certFile, keyFile), false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			configFile := writeTestNATSConfig(t, test.config)
+			_, err := server.ProcessConfigFile(configFile)
+			if err == nil {
+				t.Fatalf("NATS configuration should be invalid")
+			}
+			files, filesErr := findTLSFiles(newTestFlagSet(t, "-c", configFile))
+			if filesErr != nil {
+				t.Fatalf(filesErr.Error())
+			}
+			if got := onlyMissingFiles(err, missingManagedFiles(files, config)); got != test.deferred {
+				t.Errorf("Bad deferred startup. Want: %v. Got: %v (NATS error: %v)", test.deferred, got, err)
+			}
+		})
+	}
+}
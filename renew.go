@@ -0,0 +1,414 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/procyon-projects/chrono"
+
+	"github.com/quara-dev/letsgo-nats/acme"
+	"github.com/quara-dev/letsgo-nats/configuration"
+)
+
+// Delay between two certificate expiration checks
+const RENEW_CHECK_INTERVAL = 24 * time.Hour
+
+// Maximum delay of a renewal attempt past its scheduled time, before the task is considered stuck
+const RENEW_STUCK_TIMEOUT = time.Hour
+
+// Task checking certificate expiration and renewing certificates
+//
+// When renewal fails, the task is retried according to the retry policy
+// instead of waiting for the next daily check.
+type renewTask struct {
+	log       server.Logger
+	config    *configuration.UserConfig
+	holder    *acme.CertificateHolder
+	reloadFn  func() error
+	renewFn   func(*configuration.UserConfig) (bool, error)
+	policy    acme.RetryPolicy
+	scheduler chrono.TaskScheduler
+
+	// Prevent scheduled and requested renewals from running concurrently
+	running sync.Mutex
+
+	mu          sync.Mutex
+	next        chrono.ScheduledTask
+	nextRun     time.Time
+	failures    int
+	lastAttempt time.Time
+	lastError   error
+	operation   *operationStatus
+	// Renewed certificates are installed, but not used yet because NATS server failed to reload
+	reloadPending bool
+}
+
+// Error met while signaling a NATS server running in another process to reload
+type signalError struct {
+	err error
+}
+
+func (e *signalError) Error() string {
+	return fmt.Sprintf("Failed to signal NATS server: %v", e.err)
+}
+
+func (e *signalError) Unwrap() error {
+	return e.err
+}
+
+// State of the renewal task
+type renewStatus struct {
+	LastAttempt time.Time
+	LastError   error
+	Failures    int
+	NextRun     time.Time
+	Operation   *operationStatus
+}
+
+// State of the last operation requested through admin service
+type operationStatus struct {
+	Name       string
+	StartedAt  time.Time
+	FinishedAt time.Time
+	Revoked    bool
+	Renewed    bool
+	Error      error
+}
+
+func (t *renewTask) run(ctx context.Context) {
+	t.running.Lock()
+	defer t.running.Unlock()
+	t.attempted()
+	// Renewed certificates must be used before checking their expiration
+	if err := t.retryReload(); err != nil {
+		t.reschedule(false, err)
+		return
+	}
+	t.log.Debugf("Checking certificate expiration")
+	renewed, err := t.renewFn(t.config)
+	t.handleResult(renewed, err)
+}
+
+// Reload NATS server when renewed certificates are not in use because a previous reload failed.
+//
+// Renewed certificates are already installed, so only the reload is retried, without requesting new certificates.
+func (t *renewTask) retryReload() error {
+	t.mu.Lock()
+	pending := t.reloadPending
+	t.mu.Unlock()
+	if !pending {
+		return nil
+	}
+	t.log.Noticef("Retrying to use renewed TLS certificates")
+	return t.reload()
+}
+
+// Renew certificates now, even when renewal is not due yet.
+//
+// Next check is rescheduled according to the result.
+func (t *renewTask) renewNow() (bool, error) {
+	t.running.Lock()
+	defer t.running.Unlock()
+	t.log.Noticef("Renewing TLS certificates on request")
+	t.attempted()
+	if err := t.retryReload(); err != nil {
+		return false, t.reschedule(false, err)
+	}
+	renewed, err := acme.ForceRenewCertificate(t.config)
+	return renewed, t.handleResult(renewed, err)
+}
+
+// Renew certificates, then revoke the certificates they replaced.
+//
+// Certificates are only revoked once renewed certificates are in use, so that
+// NATS server never serves a revoked certificate. Return whether certificates
+// were revoked, and whether they were renewed.
+func (t *renewTask) revokeNow(reason uint) (bool, bool, error) {
+	t.running.Lock()
+	defer t.running.Unlock()
+	t.log.Noticef("Replacing and revoking TLS certificates on request")
+	t.attempted()
+	// Certificates to revoke must be the certificates in use
+	if err := t.retryReload(); err != nil {
+		return false, false, t.reschedule(false, err)
+	}
+	previous := acme.LoadCertificatesPEM(t.config)
+	renewed, err := acme.ForceRenewCertificate(t.config)
+	inUse, err := t.useRenewed(renewed, err)
+	err = t.reschedule(renewed, err)
+	if !inUse {
+		return false, renewed, err
+	}
+	// Revocation errors do not affect renewal schedule, since renewed certificates are in use
+	revoked, revokeErr := acme.RevokeReplacedCertificates(t.config, previous, reason)
+	if revokeErr != nil {
+		t.log.Errorf("Failed to revoke replaced TLS certificates: %v", revokeErr)
+		if err != nil {
+			revokeErr = errors.New(fmt.Sprintf("%v; %v", err, revokeErr))
+		}
+		err = revokeErr
+	}
+	return revoked > 0, renewed, err
+}
+
+// Start an operation in background, unless an operation is already running.
+//
+// Result of the operation is available in task status.
+func (t *renewTask) startOperation(name string, run func() (bool, bool, error)) error {
+	t.mu.Lock()
+	if t.operation != nil && t.operation.FinishedAt.IsZero() {
+		running := t.operation.Name
+		t.mu.Unlock()
+		return errors.New(fmt.Sprintf("Operation %s is already running", running))
+	}
+	op := &operationStatus{Name: name, StartedAt: time.Now()}
+	t.operation = op
+	t.mu.Unlock()
+	go func() {
+		revoked, renewed, err := run()
+		t.mu.Lock()
+		op.FinishedAt = time.Now()
+		op.Revoked = revoked
+		op.Renewed = renewed
+		op.Error = err
+		t.mu.Unlock()
+	}()
+	return nil
+}
+
+// Renew certificates in background
+func (t *renewTask) requestRenewal() error {
+	return t.startOperation("renew", func() (bool, bool, error) {
+		renewed, err := t.renewNow()
+		return false, renewed, err
+	})
+}
+
+// Renew certificates, then revoke the certificates they replaced, in background
+func (t *renewTask) requestRevocation(reason uint) error {
+	return t.startOperation("revoke", func() (bool, bool, error) {
+		return t.revokeNow(reason)
+	})
+}
+
+// Get the state of the renewal task
+func (t *renewTask) status() renewStatus {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	status := renewStatus{
+		LastAttempt: t.lastAttempt,
+		LastError:   t.lastError,
+		Failures:    t.failures,
+		NextRun:     t.nextRun,
+	}
+	if t.operation != nil {
+		operation := *t.operation
+		status.Operation = &operation
+	}
+	return status
+}
+
+// Check that the task is alive, i.e. that its last scheduled run did not get stuck
+func (t *renewTask) alive() error {
+	status := t.status()
+	if status.NextRun.IsZero() {
+		return errors.New("Certificate renewal task is not scheduled")
+	}
+	if late := time.Since(status.NextRun); late > RENEW_STUCK_TIMEOUT {
+		return errors.New(fmt.Sprintf("Certificate renewal task is stuck since %s", status.NextRun.Format(time.RFC3339)))
+	}
+	return nil
+}
+
+// Record the time of a renewal attempt
+func (t *renewTask) attempted() {
+	t.mu.Lock()
+	t.lastAttempt = time.Now()
+	t.mu.Unlock()
+}
+
+// Use renewed certificates, then reschedule the task according to the result of a renewal attempt.
+//
+// Return the error of the attempt, including errors met while using renewed certificates.
+func (t *renewTask) handleResult(renewed bool, err error) error {
+	_, err = t.useRenewed(renewed, err)
+	return t.reschedule(renewed, err)
+}
+
+// Use renewed certificates, if any.
+//
+// Return whether renewed certificates are in use, and the error of the attempt
+// including errors met while using renewed certificates.
+func (t *renewTask) useRenewed(renewed bool, err error) (bool, error) {
+	if !renewed {
+		return false, err
+	}
+	// Reload even when some certificates failed, so that renewed certificates are used
+	reloadErr := t.reload()
+	if reloadErr == nil {
+		return true, err
+	}
+	if err != nil {
+		reloadErr = errors.New(fmt.Sprintf("%v; %v", err, reloadErr))
+	}
+	return false, reloadErr
+}
+
+// Reschedule the task according to the result of a renewal attempt, and return the error of the attempt
+func (t *renewTask) reschedule(renewed bool, err error) error {
+	if err != nil {
+		t.mu.Lock()
+		t.failures += 1
+		t.lastError = err
+		failures := t.failures
+		t.mu.Unlock()
+		// Use current certificate expiration date to adjust retry delay
+		var notAfter time.Time
+		if cert, certErr := acme.ReadCertificate(t.config); certErr == nil {
+			notAfter = cert.NotAfter
+		}
+		delay := t.policy.NextDelay(failures, notAfter)
+		t.log.Errorf("Failed to renew TLS certificates (%d consecutive failures): %v", failures, err)
+		t.log.Noticef("Certificate renewal will be retried in %s", delay.Round(time.Second))
+		t.schedule(delay)
+		return err
+	}
+	t.mu.Lock()
+	if t.failures > 0 {
+		t.log.Noticef("Certificate renewal succeeded after %d consecutive failures", t.failures)
+	}
+	t.failures = 0
+	t.lastError = nil
+	t.mu.Unlock()
+	if !renewed {
+		t.log.Noticef("Skipping TLS certificate request. Certificate renewal is not due yet")
+	}
+	t.schedule(RENEW_CHECK_INTERVAL)
+	return nil
+}
+
+// Use renewed certificates.
+//
+// When certificates are injected into NATS listeners, renewed certificates are
+// loaded into the certificate holder and used on the next TLS handshake.
+// Otherwise, NATS server is reloaded, either in process or by signaling the
+// NATS server managed in sidecar or supervisor mode. NATS server started
+// without configuration file cannot be reloaded, and uses renewed certificates
+// once restarted.
+//
+// Previous certificates are only restored when renewed certificates are
+// invalid. When reload fails for another reason, e.g. an invalid NATS
+// configuration file, renewed certificates are kept and the reload is retried
+// by the task, without requesting new certificates.
+func (t *renewTask) reload() error {
+	var err error
+	if t.holder != nil {
+		t.log.Noticef("Loading renewed TLS certificates")
+		err = t.holder.Reload()
+	} else if t.reloadFn == nil {
+		natsReloads.Inc("skipped")
+		t.log.Warnf("NATS server was started without configuration file and cannot be reloaded. Renewed TLS certificates will be used once NATS server is restarted")
+		t.commit()
+		return nil
+	} else {
+		t.log.Noticef("Reloading NATS server due to TLS certificates changes")
+		err = t.reloadFn()
+	}
+	if err == nil {
+		natsReloads.Inc("success")
+		t.commit()
+		return nil
+	}
+	// NATS server running in another process could not be signaled, which does not
+	// mean that renewed certificates are invalid: it loads them once reloaded or restarted.
+	var sigErr *signalError
+	if errors.As(err, &sigErr) {
+		natsReloads.Inc("unsignaled")
+		t.log.Warnf("Renewed TLS certificates will be used once NATS server is reloaded or restarted: %v", err)
+		t.commit()
+		return nil
+	}
+	if validateErr := acme.ValidateInstalledCertificates(t.config); validateErr == nil {
+		natsReloads.Inc("pending")
+		t.mu.Lock()
+		t.reloadPending = true
+		t.mu.Unlock()
+		return errors.New(fmt.Sprintf("Failed to use renewed TLS certificates: %v. Renewed TLS certificates are valid and kept until NATS server is reloaded", err))
+	}
+	// Previous certificates are in use once restored
+	t.mu.Lock()
+	t.reloadPending = false
+	t.mu.Unlock()
+	restored, restoreErr := acme.RestoreCertificate(t.config)
+	if restoreErr != nil || restored == "" {
+		natsReloads.Inc("failure")
+	} else {
+		natsReloads.Inc("restored")
+	}
+	if restoreErr != nil {
+		return errors.New(fmt.Sprintf("Failed to use renewed TLS certificates: %v. Failed to restore previous TLS certificates: %v", err, restoreErr))
+	}
+	if restored == "" {
+		return errors.New(fmt.Sprintf("Failed to use renewed TLS certificates: %v. No previous TLS certificates to restore", err))
+	}
+	t.log.Warnf("Restored previous TLS certificates version %s", restored)
+	return errors.New(fmt.Sprintf("Failed to use renewed TLS certificates: %v. Previous TLS certificates were restored", err))
+}
+
+// Keep renewed certificates, previous version is no longer needed
+func (t *renewTask) commit() {
+	t.mu.Lock()
+	t.reloadPending = false
+	t.mu.Unlock()
+	if err := acme.CommitCertificate(t.config); err != nil {
+		t.log.Warnf("Failed to commit TLS certificates version: %v", err)
+	}
+}
+
+// Schedule next run of the task, replacing the run scheduled previously
+func (t *renewTask) schedule(delay time.Duration) {
+	nextRun := time.Now().Add(delay)
+	next, err := t.scheduler.Schedule(t.run, chrono.WithTime(nextRun))
+	if err != nil {
+		t.log.Fatalf("Failed to schedule certificate renewal task: %v", err)
+		return
+	}
+	t.mu.Lock()
+	if t.next != nil {
+		t.next.Cancel()
+	}
+	t.next = next
+	t.nextRun = nextRun
+	t.mu.Unlock()
+}
+
+// Start the renewal task.
+//
+// When renewal failed on startup, first retry is scheduled according to retry
+// policy, otherwise certificates are checked immediately. Renewed certificates
+// are loaded into holder when not nil, otherwise NATS server is reloaded using reload,
+// unless reload is nil.
+func startRenewTask(log server.Logger, config *configuration.UserConfig, holder *acme.CertificateHolder, reload func() error, startupErr error) *renewTask {
+	task := &renewTask{
+		log:       log,
+		config:    config,
+		holder:    holder,
+		reloadFn:  reload,
+		renewFn:   acme.GetOrRenewCertificate,
+		policy:    acme.NewRetryPolicy(config),
+		scheduler: chrono.NewDefaultTaskScheduler(),
+	}
+	if startupErr != nil {
+		// Certificates were not renewed, so NATS server does not need to be reloaded
+		task.attempted()
+		task.handleResult(false, startupErr)
+	} else {
+		task.schedule(0)
+	}
+	log.Noticef("Certificates will be checked for renewal each day")
+	return task
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/logger"
+	"github.com/procyon-projects/chrono"
+
+	"github.com/quara-dev/letsgo-nats/acme"
+	"github.com/quara-dev/letsgo-nats/configuration"
+)
+
+// Wait until the operation of a task is finished
+func waitOperation(t *testing.T, task *renewTask) *operationStatus {
+	for i := 0; i < 100; i++ {
+		if op := task.status().Operation; op != nil && !op.FinishedAt.IsZero() {
+			return op
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("Operation did not finish")
+	return nil
+}
+
+// Test that operations run in background, one at a time
+func TestStartOperation(t *testing.T) {
+	task := &renewTask{}
+	release := make(chan struct{})
+	err := task.startOperation("renew", func() (bool, bool, error) {
+		<-release
+		return false, true, errors.New("boom")
+	})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	err = task.startOperation("revoke", func() (bool, bool, error) { return true, true, nil })
+	err_want := "Operation renew is already running"
+	if err == nil || err.Error() != err_want {
+		t.Fatalf("Bad error. Want: %s. Got: %v", err_want, err)
+	}
+	close(release)
+	op := waitOperation(t, task)
+	if op.Name != "renew" || !op.Renewed || op.Error == nil || op.Error.Error() != "boom" {
+		t.Errorf("Bad operation result: %+v", *op)
+	}
+	err = task.startOperation("revoke", func() (bool, bool, error) { return true, true, nil })
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+}
+
+// Create a renewal task using renewed certificates, i.e. with current and previous versions
+func newReloadTask(t *testing.T, reload func() error) *renewTask {
+	config := newTestConfig(t)
+	config.OutputRetention = 5
+	for _, version := range []string{"20230101T120000.000000000Z", "20230301T120000.000000000Z"} {
+		if err := os.MkdirAll(filepath.Join(config.OutputDirectory, acme.VERSIONS_DIRECTORY, version), 0o700); err != nil {
+			t.Fatalf(err.Error())
+		}
+	}
+	links := map[string]string{
+		acme.PREVIOUS_LINK: "20230101T120000.000000000Z",
+		acme.CURRENT_LINK:  "20230301T120000.000000000Z",
+	}
+	for link, version := range links {
+		if err := os.Symlink(filepath.Join(acme.VERSIONS_DIRECTORY, version), filepath.Join(config.OutputDirectory, link)); err != nil {
+			t.Fatalf(err.Error())
+		}
+	}
+	return &renewTask{
+		log:      logger.NewStdLogger(false, false, false, false, false),
+		config:   config,
+		reloadFn: reload,
+	}
+}
+
+// Get the version pointed by current link
+func currentVersion(t *testing.T, task *renewTask) string {
+	target, err := os.Readlink(filepath.Join(task.config.OutputDirectory, acme.CURRENT_LINK))
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	return filepath.Base(target)
+}
+
+// Test that renewed certificates are kept when NATS server cannot be signaled
+func TestReloadUnsignaled(t *testing.T) {
+	task := newReloadTask(t, func() error {
+		return &signalError{errors.New("no such process")}
+	})
+	unsignaled := natsReloads.Value("unsignaled")
+	if err := task.reload(); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if got := currentVersion(t, task); got != "20230301T120000.000000000Z" {
+		t.Errorf("Bad current version. Want: 20230301T120000.000000000Z. Got: %s", got)
+	}
+	if _, err := os.Lstat(filepath.Join(task.config.OutputDirectory, acme.PREVIOUS_LINK)); err == nil {
+		t.Errorf("Renewed certificates should be committed")
+	}
+	if natsReloads.Value("unsignaled") != unsignaled+1 {
+		t.Errorf("Unsignaled reload was not counted")
+	}
+}
+
+// Test that previous certificates are restored when NATS server rejects renewed certificates
+func TestReloadRestore(t *testing.T) {
+	task := newReloadTask(t, func() error {
+		return errors.New("invalid certificate")
+	})
+	err := task.reload()
+	err_want := "Failed to use renewed TLS certificates: invalid certificate. Previous TLS certificates were restored"
+	if err == nil || err.Error() != err_want {
+		t.Fatalf("Bad error. Want: %s. Got: %v", err_want, err)
+	}
+	if got := currentVersion(t, task); got != "20230101T120000.000000000Z" {
+		t.Errorf("Bad current version. Want: 20230101T120000.000000000Z. Got: %s", got)
+	}
+}
+
+// Test that renewed certificates are kept when NATS server keeps failing to reload for another reason,
+// and that only the reload is retried, without requesting new certificates
+func TestReloadPending(t *testing.T) {
+	reloadErr := errors.New("config file error")
+	reloads := 0
+	task := newReloadTask(t, func() error {
+		reloads += 1
+		return reloadErr
+	})
+	writeTestCertificate(t, task.config, time.Now().Add(-time.Hour), time.Now().Add(24*time.Hour))
+	renewals := 0
+	task.renewFn = func(config *configuration.UserConfig) (bool, error) {
+		renewals += 1
+		return false, nil
+	}
+	task.policy = acme.RetryPolicy{InitialInterval: time.Hour, MaxInterval: time.Hour, Multiplier: 2}
+	task.scheduler = chrono.NewDefaultTaskScheduler()
+	t.Cleanup(func() { <-task.scheduler.Shutdown() })
+	err := task.reload()
+	err_want := "Failed to use renewed TLS certificates: config file error. Renewed TLS certificates are valid and kept until NATS server is reloaded"
+	if err == nil || err.Error() != err_want {
+		t.Fatalf("Bad error. Want: %s. Got: %v", err_want, err)
+	}
+	for i := 0; i < 3; i++ {
+		task.run(context.Background())
+	}
+	if renewals != 0 {
+		t.Errorf("Bad number of renewals. Want: 0. Got: %d", renewals)
+	}
+	if reloads != 4 {
+		t.Errorf("Bad number of reloads. Want: 4. Got: %d", reloads)
+	}
+	if got := currentVersion(t, task); got != "20230301T120000.000000000Z" {
+		t.Errorf("Bad current version. Want: 20230301T120000.000000000Z. Got: %s", got)
+	}
+	if status := task.status(); status.Failures != 3 {
+		t.Errorf("Bad number of failures. Want: 3. Got: %d", status.Failures)
+	}
+	// Renewed certificates are committed once NATS server is reloaded, then expiration is checked again
+	reloadErr = nil
+	task.run(context.Background())
+	if renewals != 1 {
+		t.Errorf("Bad number of renewals. Want: 1. Got: %d", renewals)
+	}
+	if _, err := os.Lstat(filepath.Join(task.config.OutputDirectory, acme.PREVIOUS_LINK)); err == nil {
+		t.Errorf("Renewed certificates should be committed")
+	}
+	if status := task.status(); status.Failures != 0 {
+		t.Errorf("Bad number of failures. Want: 0. Got: %d", status.Failures)
+	}
+}
+
+// Test that renewed certificates are kept when NATS server was started without configuration file
+func TestReloadWithoutConfigFile(t *testing.T) {
+	task := newReloadTask(t, nil)
+	if err := task.reload(); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if got := currentVersion(t, task); got != "20230301T120000.000000000Z" {
+		t.Errorf("Bad current version. Want: 20230301T120000.000000000Z. Got: %s", got)
+	}
+	if _, err := os.Lstat(filepath.Join(task.config.OutputDirectory, acme.PREVIOUS_LINK)); err == nil {
+		t.Errorf("Renewed certificates should be committed")
+	}
+}
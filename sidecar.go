@@ -0,0 +1,94 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/nats-io/nats-server/v2/logger"
+	"github.com/nats-io/nats-server/v2/server"
+
+	"github.com/quara-dev/letsgo-nats/configuration"
+	"github.com/quara-dev/letsgo-nats/stores"
+)
+
+var sidecarUsageStr = `
+Usage: letsgo-nats sidecar [options]
+Options:
+    -P, --pid <pid>                  PID or path to the PID file of the NATS server to reload
+                                     when certificates are renewed (default: find nats-server process)
+    -D, --debug                      Enable debugging output
+`
+
+// Get a function reloading an external NATS server, with the same semantics as --signal reload
+func signalReload(pid string) func() error {
+	return func() error {
+		if err := server.ProcessSignal(server.CommandReload, pid); err != nil {
+			return &signalError{err}
+		}
+		return nil
+	}
+}
+
+// Warn about options which require an embedded NATS server, when NATS server runs in another process
+func warnExternalServerOptions(log server.Logger, config *configuration.UserConfig, mode string) {
+	if len(config.TLSListeners) > 0 {
+		log.Warnf("TLS_LISTENERS is ignored in %s mode. NATS server must read certificates from OUTPUT_DIRECTORY", mode)
+	}
+	if config.AdminUser != "" {
+		log.Warnf("Admin service is not available in %s mode", mode)
+	}
+	if config.EventsSubject != "" {
+		log.Warnf("Certificate events are not published in %s mode", mode)
+	}
+}
+
+// Run sidecar mode: manage certificates of a NATS server running in another process.
+//
+// Certificates are requested and renewed like in embedded mode, and the external
+// NATS server is signaled to reload its configuration after each renewal.
+func runSidecarCommand(args []string) int {
+	fs := flag.NewFlagSet("sidecar", flag.ContinueOnError)
+	fs.Usage = func() { fmt.Fprint(os.Stderr, sidecarUsageStr) }
+	var pid string
+	var debug bool
+	fs.StringVar(&pid, "P", "", "")
+	fs.StringVar(&pid, "pid", "", "")
+	fs.BoolVar(&debug, "D", false, "")
+	fs.BoolVar(&debug, "debug", false, "")
+	if err := fs.Parse(args); err != nil || fs.NArg() > 0 {
+		if err == nil {
+			fs.Usage()
+		}
+		return 2
+	}
+	log := logger.NewStdLogger(true, debug, false, false, false)
+	stores := stores.DefaultStores()
+	config, err := configuration.NewUserConfig(&stores)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "letsgo-nats: %v\n", err)
+		return 1
+	}
+	warnExternalServerOptions(log, config, "sidecar")
+	reload := signalReload(pid)
+	startup, err := getStartupCertificates(config)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "letsgo-nats: %v\n", err)
+		return 1
+	}
+	if startup.renewed {
+		// NATS server may not be started yet, in which case it loads certificates on startup
+		log.Noticef("Reloading NATS server due to TLS certificates changes")
+		if err := reload(); err != nil {
+			log.Warnf("Failed to reload NATS server: %v", err)
+		}
+	}
+	startup.manage(log, nil, nil, reload)
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGINT, syscall.SIGTERM)
+	sig := <-c
+	log.Noticef("Trapped %q signal, exiting", sig)
+	return 0
+}
@@ -0,0 +1,16 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+// Test that failing to signal NATS server is reported as a signal error, so that renewed certificates are kept
+func TestSignalReloadMissingPidFile(t *testing.T) {
+	err := signalReload(filepath.Join(t.TempDir(), "nats-server.pid"))()
+	var sigErr *signalError
+	if !errors.As(err, &sigErr) {
+		t.Errorf("Bad error. Want: signal error. Got: %v", err)
+	}
+}
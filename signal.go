@@ -0,0 +1,53 @@
+//go:build !windows
+
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/nats-io/nats-server/v2/server"
+
+	"github.com/quara-dev/letsgo-nats/acme"
+	"github.com/quara-dev/letsgo-nats/configuration"
+)
+
+// Handle signals in place of NATS server when managed certificates are injected.
+//
+// NATS server reloads its configuration file on SIGHUP, which would drop the TLS
+// configuration of listeners using managed certificates. NATS server signal
+// handling must be disabled (opts.NoSigs) before server is created.
+func handleSignals(ns *server.Server, configFile string, config *configuration.UserConfig, holder *acme.CertificateHolder) {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGINT, syscall.SIGTERM, syscall.SIGUSR1, syscall.SIGUSR2, syscall.SIGHUP)
+	go func() {
+		for sig := range c {
+			ns.Debugf("Trapped %q signal", sig)
+			switch sig {
+			case syscall.SIGINT:
+				ns.Shutdown()
+				os.Exit(0)
+			case syscall.SIGTERM:
+				ns.Shutdown()
+				os.Exit(1)
+			case syscall.SIGUSR1:
+				// File log re-open for rotating file logs.
+				ns.ReOpenLogFile()
+			case syscall.SIGUSR2:
+				// Lame duck mode, as NATS server does on SIGUSR2
+				go ns.LameDuckShutdown()
+			case syscall.SIGHUP:
+				// Config reload, keeping managed certificates
+				if err := reloadServer(ns, configFile, config, holder); err != nil {
+					ns.Errorf("Failed to reload server configuration: %s", err)
+				}
+			}
+		}
+	}()
+}
+
+// Check whether NATS server signal handling must be replaced
+func replacesSignals(config *configuration.UserConfig) bool {
+	return len(config.TLSListeners) > 0
+}
@@ -0,0 +1,19 @@
+//go:build windows
+
+package main
+
+import (
+	"github.com/nats-io/nats-server/v2/server"
+
+	"github.com/quara-dev/letsgo-nats/acme"
+	"github.com/quara-dev/letsgo-nats/configuration"
+)
+
+// Signals are handled by NATS server on Windows
+func handleSignals(ns *server.Server, configFile string, config *configuration.UserConfig, holder *acme.CertificateHolder) {
+}
+
+// Check whether NATS server signal handling must be replaced
+func replacesSignals(config *configuration.UserConfig) bool {
+	return false
+}
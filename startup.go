@@ -0,0 +1,60 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/nats-io/nats-server/v2/server"
+
+	"github.com/quara-dev/letsgo-nats/acme"
+	"github.com/quara-dev/letsgo-nats/configuration"
+)
+
+// Certificates obtained on startup, before NATS server uses them
+type startupCertificates struct {
+	config  *configuration.UserConfig
+	renewed bool
+	err     error
+}
+
+// Get certificates on startup, in every mode.
+//
+// Certificate is either:
+//   - renewed if its renewal window (suggested by CA or computed from lifetime) is reached
+//   - created if it does not exist yet
+//   - left untouched otherwise
+//
+// When renewal fails, startup continues with existing certificates as long as
+// they are valid, and the renewal task retries in background. An error is
+// returned when no usable certificate exists.
+func getStartupCertificates(config *configuration.UserConfig) (*startupCertificates, error) {
+	renewed, err := acme.GetOrRenewCertificate(config)
+	if err != nil {
+		if checkErr := acme.CheckCertificates(config); checkErr != nil {
+			return nil, errors.New(fmt.Sprintf("%v. No usable TLS certificate: %v", err, checkErr))
+		}
+	}
+	return &startupCertificates{config: config, renewed: renewed, err: err}, nil
+}
+
+// Manage certificates once NATS server loaded startup certificates, or is about to load them.
+//
+// Previous certificates are no longer needed, and the renewal task is started
+// along with metrics and probes listeners. ns is nil when NATS server runs in
+// another process. Renewed certificates are loaded into holder when not nil,
+// otherwise NATS server is reloaded using reload, unless reload is nil.
+func (c *startupCertificates) manage(log server.Logger, ns *server.Server, holder *acme.CertificateHolder, reload func() error) *renewTask {
+	if c.err != nil {
+		log.Warnf("Failed to renew TLS certificates on startup. Using existing certificates, which are still valid")
+	}
+	if err := acme.CommitCertificate(c.config); err != nil {
+		log.Warnf("Failed to commit TLS certificates version: %v", err)
+	}
+	// Start certificate renewal task
+	task := startRenewTask(log, c.config, holder, reload, c.err)
+	// Serve metrics and probes
+	if err := startHTTPListeners(log, ns, c.config, holder, task); err != nil {
+		log.Errorf("Failed to start HTTP listener: %v", err)
+	}
+	return task
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Test that startup continues with valid existing certificates only
+func TestGetStartupCertificates(t *testing.T) {
+	// ACME server is unavailable, so certificates cannot be requested
+	ca := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer ca.Close()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	config := newTestConfig(t)
+	config.Email = "support@example.com"
+	config.AccountKeyFile = filepath.Join(t.TempDir(), "account.key")
+	config.CADirURL = ca.URL + "/directory"
+	config.Key = key
+	_, err = getStartupCertificates(config)
+	if err == nil || !strings.Contains(err.Error(), "No usable TLS certificate") {
+		t.Fatalf("Bad error. Want: No usable TLS certificate. Got: %v", err)
+	}
+	// Existing certificate does not match configuration, but is still valid
+	writeTestCertificate(t, config, time.Now().Add(-time.Hour), time.Now().Add(24*time.Hour))
+	config.Domains = append(config.Domains, "www.example.com")
+	startup, err := getStartupCertificates(config)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if startup.renewed || startup.err == nil {
+		t.Errorf("Bad startup certificates. Want: renewal error. Got: %v %v", startup.renewed, startup.err)
+	}
+}
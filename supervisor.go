@@ -0,0 +1,224 @@
+//go:build !windows
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/logger"
+	"github.com/nats-io/nats-server/v2/server"
+
+	"github.com/quara-dev/letsgo-nats/configuration"
+	"github.com/quara-dev/letsgo-nats/metrics"
+	"github.com/quara-dev/letsgo-nats/stores"
+)
+
+// Delay before restarting NATS server after its first crash
+const SUPERVISOR_MIN_BACKOFF = time.Second
+
+// Maximum delay before restarting NATS server
+const SUPERVISOR_MAX_BACKOFF = time.Minute
+
+// Minimum run duration of NATS server for the restart delay to be reset
+const SUPERVISOR_STABLE_RUN = time.Minute
+
+var supervisorUsageStr = `
+Usage: letsgo-nats supervisor [options] [-- <nats-server options>]
+Options:
+        --nats-server <path>         NATS server binary to launch (default: nats-server found in PATH)
+    -D, --debug                      Enable debugging output
+`
+
+var natsRestarts = metrics.NewCounter(
+	"letsgo_nats_restarts_total",
+	"Number of restarts of the NATS server launched in supervisor mode.",
+)
+
+// Supervisor of a NATS server child process.
+//
+// NATS server is restarted with an exponential backoff when it exits, until
+// the supervisor is stopped.
+type supervisor struct {
+	log  server.Logger
+	path string
+	args []string
+
+	mu       sync.Mutex
+	cmd      *exec.Cmd
+	stopping bool
+	stopped  chan struct{}
+}
+
+// Error returned when starting NATS server once supervisor is stopped
+var errSupervisorStopped = errors.New("Supervisor is stopped")
+
+// Start NATS server child process, unless supervisor is stopped.
+//
+// Stopping is checked while holding the lock, so that a stop request either
+// prevents NATS server from starting, or is forwarded to the started process.
+func (s *supervisor) start() (*exec.Cmd, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stopping {
+		return nil, errSupervisorStopped
+	}
+	cmd := exec.Command(s.path, s.args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	// Signals sent to the terminal process group are forwarded by the supervisor instead
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	s.cmd = cmd
+	s.log.Noticef("Started NATS server %s (pid %d)", s.path, cmd.Process.Pid)
+	return cmd, nil
+}
+
+// Run NATS server until the supervisor is stopped, and return the exit code of NATS server
+func (s *supervisor) run() int {
+	delay := SUPERVISOR_MIN_BACKOFF
+	code := 0
+	for {
+		startedAt := time.Now()
+		cmd, err := s.start()
+		if errors.Is(err, errSupervisorStopped) {
+			return code
+		}
+		code = 1
+		if err != nil {
+			s.log.Errorf("Failed to start NATS server: %v", err)
+		} else {
+			err = cmd.Wait()
+			s.mu.Lock()
+			s.cmd = nil
+			s.mu.Unlock()
+			if code = cmd.ProcessState.ExitCode(); code < 0 {
+				code = 1
+			}
+			if err != nil {
+				s.log.Warnf("NATS server exited: %v", err)
+			} else {
+				s.log.Noticef("NATS server exited")
+			}
+			if time.Since(startedAt) >= SUPERVISOR_STABLE_RUN {
+				delay = SUPERVISOR_MIN_BACKOFF
+			}
+		}
+		select {
+		case <-s.stopped:
+			return code
+		default:
+		}
+		s.log.Noticef("NATS server will be restarted in %s", delay)
+		select {
+		case <-s.stopped:
+			return code
+		case <-time.After(delay):
+		}
+		natsRestarts.Inc()
+		delay *= 2
+		if delay > SUPERVISOR_MAX_BACKOFF {
+			delay = SUPERVISOR_MAX_BACKOFF
+		}
+	}
+}
+
+// Send a signal to NATS server
+func (s *supervisor) signal(sig os.Signal) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.cmd == nil {
+		return errors.New("NATS server is not running")
+	}
+	return s.cmd.Process.Signal(sig)
+}
+
+// Reload NATS server configuration, including certificates.
+//
+// NATS server which is not running, e.g. while it is restarted, loads renewed
+// certificates once started, so failures are reported as signal errors.
+func (s *supervisor) reload() error {
+	if err := s.signal(syscall.SIGHUP); err != nil {
+		return &signalError{err}
+	}
+	return nil
+}
+
+// Stop NATS server using sig, without restarting it
+func (s *supervisor) stop(sig os.Signal) {
+	s.mu.Lock()
+	if !s.stopping {
+		s.stopping = true
+		close(s.stopped)
+	}
+	s.mu.Unlock()
+	s.signal(sig)
+}
+
+// Forward signals to NATS server. NATS server is stopped on SIGINT and SIGTERM.
+func (s *supervisor) forwardSignals() {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGINT, syscall.SIGTERM, syscall.SIGUSR1, syscall.SIGUSR2, syscall.SIGHUP)
+	go func() {
+		for sig := range c {
+			s.log.Debugf("Trapped %q signal, forwarding to NATS server", sig)
+			switch sig {
+			case syscall.SIGINT, syscall.SIGTERM:
+				s.stop(sig)
+			default:
+				if err := s.signal(sig); err != nil {
+					s.log.Warnf("Failed to forward %q signal: %v", sig, err)
+				}
+			}
+		}
+	}()
+}
+
+// Run supervisor mode: launch a NATS server binary as a child process and manage its certificates.
+//
+// Certificates are requested before NATS server is started, and NATS server is
+// sent SIGHUP after each renewal. Arguments following "--" are passed to NATS server.
+func runSupervisorCommand(args []string) int {
+	fs := flag.NewFlagSet("supervisor", flag.ContinueOnError)
+	fs.Usage = func() { fmt.Fprint(os.Stderr, supervisorUsageStr) }
+	var path string
+	var debug bool
+	fs.StringVar(&path, "nats-server", "nats-server", "")
+	fs.BoolVar(&debug, "D", false, "")
+	fs.BoolVar(&debug, "debug", false, "")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	path, err := exec.LookPath(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "letsgo-nats: %v\n", err)
+		return 1
+	}
+	log := logger.NewStdLogger(true, debug, false, false, false)
+	stores := stores.DefaultStores()
+	config, err := configuration.NewUserConfig(&stores)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "letsgo-nats: %v\n", err)
+		return 1
+	}
+	warnExternalServerOptions(log, config, "supervisor")
+	startup, err := getStartupCertificates(config)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "letsgo-nats: %v\n", err)
+		return 1
+	}
+	s := &supervisor{log: log, path: path, args: fs.Args(), stopped: make(chan struct{})}
+	s.forwardSignals()
+	// NATS server is not started yet, so it loads current certificates on startup
+	startup.manage(log, nil, nil, s.reload)
+	return s.run()
+}
@@ -0,0 +1,88 @@
+//go:build !windows
+
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/logger"
+)
+
+// Create a supervisor of a shell script standing for NATS server
+func newTestSupervisor(t *testing.T, script string) *supervisor {
+	path := filepath.Join(t.TempDir(), "nats-server")
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+script), 0o700); err != nil {
+		t.Fatalf(err.Error())
+	}
+	return &supervisor{
+		log:     logger.NewStdLogger(false, false, false, false, false),
+		path:    path,
+		stopped: make(chan struct{}),
+	}
+}
+
+// Run supervisor in background, and return a channel receiving its exit code
+func runTestSupervisor(s *supervisor) chan int {
+	done := make(chan int, 1)
+	go func() { done <- s.run() }()
+	return done
+}
+
+// Wait for supervisor to exit, and return its exit code
+func waitTestSupervisor(t *testing.T, done chan int) int {
+	select {
+	case code := <-done:
+		return code
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Supervisor did not exit")
+		return 0
+	}
+}
+
+// Test that NATS server is not started when supervisor is stopped before startup
+func TestSupervisorStoppedBeforeStart(t *testing.T) {
+	s := newTestSupervisor(t, "sleep 60\n")
+	s.stop(syscall.SIGTERM)
+	code := waitTestSupervisor(t, runTestSupervisor(s))
+	if code != 0 {
+		t.Errorf("Bad exit code. Want: 0. Got: %d", code)
+	}
+}
+
+// Test that NATS server is restarted when it crashes, and that reloads are not failures while it is restarted
+func TestSupervisorRestart(t *testing.T) {
+	marker := filepath.Join(t.TempDir(), "crashed")
+	s := newTestSupervisor(t, "if [ ! -f "+marker+" ]; then touch "+marker+"; exit 3; fi\ntrap 'exit 0' TERM\ntrap '' HUP\nwhile true; do sleep 0.1; done\n")
+	restarts := natsRestarts.Value()
+	done := runTestSupervisor(s)
+	// Wait for NATS server to crash
+	for i := 0; i < 100; i++ {
+		if _, err := os.Stat(marker); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	time.Sleep(100 * time.Millisecond)
+	var sigErr *signalError
+	if err := s.reload(); !errors.As(err, &sigErr) {
+		t.Errorf("Bad reload error while NATS server is restarted. Want: signal error. Got: %v", err)
+	}
+	// Wait for NATS server to be restarted
+	time.Sleep(SUPERVISOR_MIN_BACKOFF + 500*time.Millisecond)
+	if natsRestarts.Value() != restarts+1 {
+		t.Errorf("Bad number of restarts. Want: %v. Got: %v", restarts+1, natsRestarts.Value())
+	}
+	if err := s.reload(); err != nil {
+		t.Errorf(err.Error())
+	}
+	s.stop(syscall.SIGTERM)
+	code := waitTestSupervisor(t, done)
+	if code != 0 {
+		t.Errorf("Bad exit code. Want: 0. Got: %d", code)
+	}
+}
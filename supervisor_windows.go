@@ -0,0 +1,14 @@
+//go:build windows
+
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// Supervisor mode relies on SIGHUP to reload NATS server, which is not available on Windows
+func runSupervisorCommand(args []string) int {
+	fmt.Fprintf(os.Stderr, "letsgo-nats: supervisor mode is not supported on Windows\n")
+	return 1
+}
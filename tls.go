@@ -0,0 +1,91 @@
+package main
+
+import (
+	"crypto/tls"
+
+	"github.com/nats-io/nats-server/v2/server"
+	"golang.org/x/exp/slices"
+
+	"github.com/quara-dev/letsgo-nats/acme"
+	"github.com/quara-dev/letsgo-nats/configuration"
+	"github.com/quara-dev/letsgo-nats/constants"
+)
+
+// Get a TLS configuration serving managed certificates.
+//
+// Settings found in NATS configuration (e.g. client verification) are kept,
+// only certificates are replaced. Certificates are selected on each handshake
+// from the certificate holder, so that renewed certificates are used without
+// reloading NATS server.
+func withCertificates(config *tls.Config, holder *acme.CertificateHolder) (*tls.Config, error) {
+	if config == nil {
+		var err error
+		config, err = server.GenTLSConfig(&server.TLSConfigOpts{})
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		config = config.Clone()
+	}
+	// Certificates must be empty, otherwise GetCertificate is only called when client sends SNI
+	config.Certificates = nil
+	config.GetCertificate = holder.GetCertificate
+	config.GetClientCertificate = holder.GetClientCertificate
+	return config, nil
+}
+
+// Configure NATS listeners listed in TLS_LISTENERS to use managed certificates
+func injectTLSConfig(opts *server.Options, config *configuration.UserConfig, holder *acme.CertificateHolder) error {
+	if len(config.TLSListeners) == 0 {
+		return nil
+	}
+	var err error
+	// HTTPS monitoring uses client TLS configuration
+	if slices.Contains(config.TLSListeners, constants.TLS_LISTENER_CLIENT) {
+		if opts.TLSConfig, err = withCertificates(opts.TLSConfig, holder); err != nil {
+			return err
+		}
+		opts.TLSCert, opts.TLSKey = acme.CertificatePaths(config)
+		opts.TLS = true
+	}
+	if slices.Contains(config.TLSListeners, constants.TLS_LISTENER_WEBSOCKET) {
+		if opts.Websocket.TLSConfig, err = withCertificates(opts.Websocket.TLSConfig, holder); err != nil {
+			return err
+		}
+	}
+	if slices.Contains(config.TLSListeners, constants.TLS_LISTENER_MQTT) {
+		if opts.MQTT.TLSConfig, err = withCertificates(opts.MQTT.TLSConfig, holder); err != nil {
+			return err
+		}
+	}
+	if slices.Contains(config.TLSListeners, constants.TLS_LISTENER_LEAFNODE) {
+		if opts.LeafNode.TLSConfig, err = withCertificates(opts.LeafNode.TLSConfig, holder); err != nil {
+			return err
+		}
+	}
+	if slices.Contains(config.TLSListeners, constants.TLS_LISTENER_GATEWAY) {
+		if opts.Gateway.TLSConfig, err = withCertificates(opts.Gateway.TLSConfig, holder); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Reload NATS server configuration.
+//
+// When managed certificates are injected into NATS options, configuration file
+// is processed again and certificates are injected before options are applied.
+func reloadServer(ns *server.Server, configFile string, config *configuration.UserConfig, holder *acme.CertificateHolder) error {
+	if len(config.TLSListeners) == 0 {
+		return ns.Reload()
+	}
+	opts, err := server.ProcessConfigFile(configFile)
+	if err != nil {
+		return err
+	}
+	err = injectTLSConfig(opts, config, holder)
+	if err != nil {
+		return err
+	}
+	return ns.ReloadOptions(opts)
+}
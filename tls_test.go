@@ -0,0 +1,130 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+
+	"github.com/quara-dev/letsgo-nats/acme"
+	"github.com/quara-dev/letsgo-nats/constants"
+)
+
+// Start an in-process NATS server, shut down at the end of the test
+func runTestServer(t *testing.T, opts *server.Options) *server.Server {
+	opts.NoLog = true
+	opts.NoSigs = true
+	ns, err := server.NewServer(opts)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	go ns.Start()
+	if !ns.ReadyForConnections(4 * time.Second) {
+		t.Fatalf("NATS server is not ready for connection")
+	}
+	t.Cleanup(ns.Shutdown)
+	return ns
+}
+
+// Test that managed certificates are injected into listeners listed in TLS_LISTENERS only
+func TestInjectTLSConfig(t *testing.T) {
+	config := newTestConfig(t)
+	config.TLSListeners = []string{constants.TLS_LISTENER_CLIENT, constants.TLS_LISTENER_WEBSOCKET, constants.TLS_LISTENER_LEAFNODE}
+	writeTestCertificate(t, config, time.Now().Add(-time.Hour), time.Now().Add(24*time.Hour))
+	holder, err := acme.NewCertificateHolder(config)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	clientTLS := &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, Certificates: []tls.Certificate{{}}}
+	mqttTLS := &tls.Config{Certificates: []tls.Certificate{{}}}
+	opts := &server.Options{TLSConfig: clientTLS}
+	opts.Websocket.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS13, Certificates: []tls.Certificate{{}}}
+	opts.MQTT.TLSConfig = mqttTLS
+	if err := injectTLSConfig(opts, config, holder); err != nil {
+		t.Fatalf(err.Error())
+	}
+	// Settings of tls {} blocks are kept, only certificates are replaced
+	if opts.TLSConfig.ClientAuth != tls.RequireAndVerifyClientCert {
+		t.Errorf("Client verification was not kept")
+	}
+	if opts.Websocket.TLSConfig.MinVersion != tls.VersionTLS13 {
+		t.Errorf("Websocket minimum TLS version was not kept")
+	}
+	if len(clientTLS.Certificates) != 1 {
+		t.Errorf("TLS configuration of NATS options must not be modified in place")
+	}
+	injected := map[string]*tls.Config{
+		constants.TLS_LISTENER_CLIENT:    opts.TLSConfig,
+		constants.TLS_LISTENER_WEBSOCKET: opts.Websocket.TLSConfig,
+		constants.TLS_LISTENER_LEAFNODE:  opts.LeafNode.TLSConfig,
+	}
+	for listener, tlsConfig := range injected {
+		if tlsConfig == nil {
+			t.Errorf("No TLS configuration for %s listener", listener)
+			continue
+		}
+		if len(tlsConfig.Certificates) != 0 {
+			t.Errorf("Certificates of %s listener were not cleared", listener)
+		}
+		if tlsConfig.GetCertificate == nil {
+			t.Errorf("Managed certificates are not served on %s listener", listener)
+		}
+	}
+	// Listeners which are not listed are left untouched
+	if opts.MQTT.TLSConfig != mqttTLS || mqttTLS.GetCertificate != nil {
+		t.Errorf("TLS configuration of MQTT listener was modified")
+	}
+	if opts.Gateway.TLSConfig != nil {
+		t.Errorf("TLS configuration of gateway listener was created")
+	}
+	certFile, keyFile := acme.CertificatePaths(config)
+	if opts.TLSCert != certFile || opts.TLSKey != keyFile {
+		t.Errorf("Bad TLS files. Want: %s %s. Got: %s %s", certFile, keyFile, opts.TLSCert, opts.TLSKey)
+	}
+	if !opts.TLS {
+		t.Errorf("TLS is not enabled on client listener")
+	}
+}
+
+// Test that managed certificates are still served once configuration file is reloaded
+func TestReloadServer(t *testing.T) {
+	config := newTestConfig(t)
+	config.TLSListeners = []string{constants.TLS_LISTENER_CLIENT}
+	writeTestCertificate(t, config, time.Now().Add(-time.Hour), time.Now().Add(24*time.Hour))
+	holder, err := acme.NewCertificateHolder(config)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	// Configuration file references certificates which are not managed
+	other := newTestConfig(t)
+	other.Domains = []string{"other.example.com"}
+	writeTestCertificate(t, other, time.Now().Add(-time.Hour), time.Now().Add(24*time.Hour))
+	certFile, keyFile := acme.CertificatePaths(other)
+	configFile := filepath.Join(t.TempDir(), "nats.conf")
+	content := fmt.Sprintf("listen: \"127.0.0.1:-1\"\ntls {\n  cert_file: %q\n  key_file: %q\n}\n", certFile, keyFile)
+	if err := os.WriteFile(configFile, []byte(content), 0o600); err != nil {
+		t.Fatalf(err.Error())
+	}
+	opts, err := server.ProcessConfigFile(configFile)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if err := injectTLSConfig(opts, config, holder); err != nil {
+		t.Fatalf(err.Error())
+	}
+	ns := runTestServer(t, opts)
+	address := ns.Addr().String()
+	if err := checkClientListener(address, 2*time.Second, config); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if err := reloadServer(ns, configFile, config, holder); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if err := checkClientListener(address, 2*time.Second, config); err != nil {
+		t.Errorf("Managed certificates are not served once reloaded: %v", err)
+	}
+}